@@ -161,9 +161,12 @@ async function uploadVideoFile(videoID) {
 
   uploadBtnSelector = 'upload-video-btn';
   setUploadButtonState(true, uploadBtnSelector);
+  // Tells this upload's progress apart from an earlier one's
+  const uploadID = crypto.randomUUID();
+  const progress = watchUploadProgress(videoID, uploadID, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/video_upload/${videoID}`, {
+    const res = await fetch(`/api/video_upload/${videoID}?upload_id=${uploadID}`, {
       method: 'POST',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -181,14 +184,65 @@ async function uploadVideoFile(videoID) {
     alert(`Error: ${error.message}`);
   }
 
+  progress.close();
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+// Shows the server's progress events for the upload on the upload button.
+// EventSource can't send the JWT, so the stream gets a progress token that
+// is only good for this video.
+function watchUploadProgress(videoID, uploadID, selector) {
+  const watcher = {
+    source: null,
+    closed: false,
+    close() {
+      this.closed = true;
+      if (this.source) this.source.close();
+    },
+  };
+  openUploadProgress(videoID, uploadID, selector, watcher);
+  return watcher;
+}
+
+async function openUploadProgress(videoID, uploadID, selector, watcher) {
+  try {
+    const res = await fetch(`/api/videos/${videoID}/progress-token`, {
+      method: 'POST',
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(data.error);
+    }
+    const { token } = await res.json();
+    if (watcher.closed) return;
+
+    const source = new EventSource(`/api/videos/${videoID}/progress?token=${encodeURIComponent(token)}&upload_id=${uploadID}`);
+    source.addEventListener('progress', (event) => {
+      const data = JSON.parse(event.data);
+      const stage = data.step ? `${data.stage} (${data.step})` : data.stage;
+      document.getElementById(selector).textContent = `${stage} ${Math.floor(data.percent)}%`;
+    });
+    source.addEventListener('completed', () => source.close());
+    source.addEventListener('failed', () => source.close());
+    watcher.source = source;
+  } catch (error) {
+    console.log(`No upload progress: ${error.message}`);
+  }
+}
+
 const videoStateHandler = createVideoStateHandler();
 
-async function getVideos() {
+// Lists the first page of videos, or appends the page after cursor
+async function getVideos(cursor) {
   try {
-    const res = await fetch('/api/videos', {
+    const params = new URLSearchParams();
+    if (cursor) {
+      params.set('cursor', cursor);
+    }
+    const res = await fetch(`/api/videos?${params}`, {
       method: 'GET',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -199,15 +253,25 @@ async function getVideos() {
       throw new Error(`Failed to get videos. Error: ${data.error}`);
     }
 
-    const videos = await res.json();
+    const page = await res.json();
     const videoList = document.getElementById('video-list');
-    videoList.innerHTML = '';
-    for (const video of videos) {
+    if (!cursor) {
+      videoList.innerHTML = '';
+    }
+    videoList.querySelector('.load-more')?.remove();
+    for (const video of page.videos) {
       const listItem = document.createElement('li');
       listItem.textContent = video.title;
       listItem.onclick = () => videoStateHandler(video.id);
       videoList.appendChild(listItem);
     }
+    if (page.next_cursor) {
+      const loadMore = document.createElement('li');
+      loadMore.className = 'load-more';
+      loadMore.textContent = `Load more (${videoList.children.length} of ${page.total})`;
+      loadMore.onclick = () => getVideos(page.next_cursor);
+      videoList.appendChild(loadMore);
+    }
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
@@ -257,12 +321,13 @@ function viewVideo(video) {
   document.getElementById('video-description-display').textContent = video.description;
 
   const thumbnailImg = document.getElementById('thumbnail-image');
-  if (!video.thumbnail_url) {
+  const thumbnails = video.thumbnails || [];
+  if (thumbnails.length === 0) {
     thumbnailImg.style.display = 'none';
+    thumbnailImg.removeAttribute('srcset');
   } else {
     thumbnailImg.style.display = 'block';
-    thumbnailImg.src = video.thumbnail_url;
-    // thumbnailImg.src = `${video.thumbnail_url}?v=${Date.now()}`
+    setThumbnailSources(thumbnailImg, thumbnails);
   }
 
   const videoPlayer = document.getElementById('video-player');
@@ -272,11 +337,46 @@ function viewVideo(video) {
     } else {
       videoPlayer.style.display = 'block';
       videoPlayer.src = video.video_url;
+      setCaptionTracks(videoPlayer, video.captions || []);
       videoPlayer.load();
     }
   }
 }
 
+// Prefers WebP renditions when the browser supports them and lets it pick
+// the width from the srcset. Legacy thumbnails have a single URL and no width.
+function setThumbnailSources(img, thumbnails) {
+  const supportsWebP = document
+    .createElement('canvas')
+    .toDataURL('image/webp')
+    .startsWith('data:image/webp');
+  const preferred = thumbnails.filter((t) =>
+    supportsWebP ? t.mime_type === 'image/webp' : t.mime_type !== 'image/webp'
+  );
+  const candidates = preferred.length > 0 ? preferred : thumbnails;
+  const sized = candidates.filter((t) => t.width > 0);
+
+  img.src = candidates[candidates.length - 1].url;
+  if (sized.length > 0) {
+    img.srcset = sized.map((t) => `${t.url} ${t.width}w`).join(', ');
+    img.sizes = '(max-width: 640px) 100vw, 640px';
+  } else {
+    img.removeAttribute('srcset');
+  }
+}
+
+function setCaptionTracks(videoPlayer, captions) {
+  videoPlayer.querySelectorAll('track').forEach((track) => track.remove());
+  for (const caption of captions) {
+    const track = document.createElement('track');
+    track.kind = 'captions';
+    track.srclang = caption.language;
+    track.label = caption.label;
+    track.src = caption.url;
+    videoPlayer.appendChild(track);
+  }
+}
+
 async function deleteVideo() {
   if (!currentVideo) {
     alert('No video selected for deletion.');
@@ -293,7 +393,7 @@ async function deleteVideo() {
     if (!res.ok) {
       throw new Error('Failed to delete video.');
     }
-    alert('Video deleted successfully.');
+    alert('Video moved to the trash.');
     document.getElementById('video-display').style.display = 'none';
     await getVideos();
   } catch (error) {
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -10,3 +16,27 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	}
 	return nil
 }
+
+func (cfg apiConfig) assetURL(filename string) string {
+	return fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, filename)
+}
+
+// Deletes the files behind thumbnails served from the assets directory.
+// URLs that point anywhere else are left alone.
+func (cfg apiConfig) removeAssets(thumbnails []database.Thumbnail) {
+	prefix := cfg.assetURL("")
+	for _, thumbnail := range thumbnails {
+		if !strings.HasPrefix(thumbnail.URL, prefix) {
+			continue
+		}
+		cfg.removeAsset(strings.TrimPrefix(thumbnail.URL, prefix))
+	}
+}
+
+func (cfg apiConfig) removeAsset(filename string) {
+	filename = filepath.Base(filename)
+	err := os.Remove(filepath.Join(cfg.assetsRoot, filename))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Couldn't remove asset %s: %v\n", filename, err)
+	}
+}
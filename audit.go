@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Appends an event for a request to the audit log, with the client's IP
+// and user agent. The action already happened, so a failure is only
+// logged.
+func (cfg *apiConfig) audit(r *http.Request, action string, actorID *uuid.UUID, targetType, targetID string, details map[string]string) {
+	cfg.recordAuditEvent(database.AuditEvent{
+		Action:     action,
+		ActorID:    actorID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         cfg.clientIP(r),
+		UserAgent:  r.UserAgent(),
+		Details:    details,
+	})
+}
+
+func (cfg *apiConfig) recordAuditEvent(event database.AuditEvent) {
+	err := cfg.db.CreateAuditEvent(event)
+	if err != nil {
+		log.Printf("Couldn't record %s audit event for %s %s: %v\n", event.Action, event.TargetType, event.TargetID, err)
+	}
+}
+
+// The address the request came from. Behind a proxy that is the proxy,
+// unless TRUST_PROXY_HEADERS says to believe its X-Forwarded-For.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			client, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(client)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Validates the bearer JWT and returns the user it was issued to.
+// On failure the error response has already been written.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// Validates the JWT and makes sure it belongs to one of the ADMIN_EMAILS.
+// On failure the error response has already been written.
+func (cfg *apiConfig) authorizeAdmin(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return uuid.Nil, false
+	}
+	if user == nil || !cfg.adminEmails[strings.ToLower(user.Email)] {
+		respondWithError(w, http.StatusForbidden, "Admins only", nil)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// Parses {videoID}, validates the JWT and makes sure the caller owns the
+// video. Videos in the trash are not found. On failure the error response has already been written.
+func (cfg *apiConfig) authorizeVideoOwner(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return database.Video{}, false
+	}
+	return cfg.authorizeVideoOwnerID(w, videoID, userID)
+}
+
+// Makes sure the user owns the video, for callers that authenticated the
+// user some other way. On failure the error response has already been
+// written.
+func (cfg *apiConfig) authorizeVideoOwnerID(w http.ResponseWriter, videoID, userID uuid.UUID) (database.Video, bool) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", errors.New("video not found"))
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "User is not the video owner", nil)
+		return database.Video{}, false
+	}
+
+	return video, true
+}
+
+// Parses {playlistID}, validates the JWT and makes sure the caller owns
+// the playlist. On failure the error response has already been written.
+func (cfg *apiConfig) authorizePlaylistOwner(w http.ResponseWriter, r *http.Request) (database.Playlist, bool) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return database.Playlist{}, false
+	}
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+	if playlist.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", errors.New("playlist not found"))
+		return database.Playlist{}, false
+	}
+	if playlist.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "User is not the playlist owner", nil)
+		return database.Playlist{}, false
+	}
+
+	return playlist, true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/scratch"
+)
+
+// Seconds clients are asked to wait when the media workers are saturated
+const mediaBusyRetryAfter = 30
+
+// A video upload needs scratch space for the upload itself and for the
+// files derived from it (normalised, remuxed, watermarked) at the same time
+const scratchSpacePerUploadByte = 4
+
+func respondMediaBusy(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(mediaBusyRetryAfter))
+	respondWithError(w, http.StatusServiceUnavailable, "Too many videos are being processed, try again later", err)
+}
+
+// Turns an upload away before its body is read if its ffmpeg runs would
+// not even get a place in the queue. Returns false if it did.
+func (cfg *apiConfig) acceptMediaWork(w http.ResponseWriter) bool {
+	if cfg.media.Busy() {
+		respondMediaBusy(w, media.ErrQueueFull)
+		return false
+	}
+	return true
+}
+
+// respondWithError for errors of ffmpeg and ffprobe runs: if the run
+// didn't get a place in the queue, the client should come back later.
+func respondWithMediaError(w http.ResponseWriter, code int, msg string, err error) {
+	if errors.Is(err, media.ErrQueueFull) {
+		respondMediaBusy(w, err)
+		return
+	}
+	respondWithError(w, code, msg, err)
+}
+
+// Turns work away if the scratch dir would have less than the configured
+// minimum free space left after using needed more bytes. Returns false if
+// it did. Where free space can't be queried every upload is accepted.
+func (cfg *apiConfig) checkScratchSpace(w http.ResponseWriter, needed int64) bool {
+	free, err := cfg.scratch.FreeBytes()
+	if errors.Is(err, scratch.ErrFreeSpaceUnknown) {
+		return true
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check free scratch space", err)
+		return false
+	}
+	if free-max(needed, 0) < cfg.scratchMinFree {
+		w.Header().Set("Retry-After", strconv.Itoa(mediaBusyRetryAfter))
+		respondWithError(w, http.StatusInsufficientStorage, "Not enough scratch space to process the upload, try again later", nil)
+		return false
+	}
+	return true
+}
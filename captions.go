@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var errInvalidCaptions = errors.New("captions are neither SRT nor WebVTT")
+
+// BCP 47 style tag: "en", "pt-BR", "zh-Hant"
+var captionLanguagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// An SRT timing line, "00:01:02,500 --> 00:01:04,000", optionally with
+// X1: X2: Y1: Y2: coordinates after it. Some writers leave out the
+// leading zero of the hours or use a dot before the milliseconds.
+var srtTimingPattern = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})[,.](\d{3})\s*-->\s*(\d+):(\d{2}):(\d{2})[,.](\d{3})(\s.*)?$`)
+
+// Returns the caption track as WebVTT. WebVTT input is passed through
+// after a sanity check, SRT input is converted: SRT cue numbers are valid
+// WebVTT cue identifiers, so only the header and the timings change.
+func convertCaptionsToWebVTT(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if !strings.Contains(text, "-->") {
+		return nil, errInvalidCaptions
+	}
+
+	if strings.HasPrefix(text, "WEBVTT") {
+		return []byte(text), nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, "-->") {
+			continue
+		}
+		timing, err := convertSRTTiming(strings.TrimSpace(line))
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = timing
+	}
+
+	return []byte("WEBVTT\n\n" + strings.Join(lines, "\n") + "\n"), nil
+}
+
+// Rewrites an SRT timing line in WebVTT's format. SRT coordinates have no
+// WebVTT equivalent and are dropped, the cue is shown where players put
+// captions by default.
+func convertSRTTiming(line string) (string, error) {
+	match := srtTimingPattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", fmt.Errorf("%w: invalid timing %q", errInvalidCaptions, line)
+	}
+	start, err := webVTTTimestamp(match[1:5])
+	if err != nil {
+		return "", err
+	}
+	end, err := webVTTTimestamp(match[5:9])
+	if err != nil {
+		return "", err
+	}
+	return start + " --> " + end, nil
+}
+
+// Formats hours, minutes, seconds and milliseconds as HH:MM:SS.mmm
+func webVTTTimestamp(parts []string) (string, error) {
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid hours %q", errInvalidCaptions, parts[0])
+	}
+	if parts[1] > "59" || parts[2] > "59" {
+		return "", fmt.Errorf("%w: invalid timestamp %s:%s:%s", errInvalidCaptions, parts[0], parts[1], parts[2])
+	}
+	return fmt.Sprintf("%02d:%s:%s.%s", hours, parts[1], parts[2], parts[3]), nil
+}
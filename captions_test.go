@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConvertCaptionsToWebVTT(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "srt",
+			input: "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nWorld\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.500\nHello\n\n2\n00:00:03.000 --> 00:00:04.000\nWorld\n",
+		},
+		{
+			name:  "single-digit hours",
+			input: "1\n0:00:01,000 --> 1:02:03,004\nHello\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 01:02:03.004\nHello\n",
+		},
+		{
+			name:  "more than 99 hours",
+			input: "1\n100:00:01,000 --> 100:00:02,000\nHello\n",
+			want:  "WEBVTT\n\n1\n100:00:01.000 --> 100:00:02.000\nHello\n",
+		},
+		{
+			name:  "crlf line endings",
+			input: "1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			name:  "byte order mark",
+			input: "\xef\xbb\xbf1\n00:00:01,000 --> 00:00:02,000\nHello\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			name:  "positional cue settings",
+			input: "1\n00:00:01,000 --> 00:00:02,000  X1:100 X2:600 Y1:20 Y2:80\nHello\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			name:  "dot before the milliseconds",
+			input: "1\n00:00:01.000 --> 00:00:02.000\nHello\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			name:  "webvtt is passed through",
+			input: "WEBVTT\r\n\r\n00:01.000 --> 00:02.000 line:0\r\nHello\r\n",
+			want:  "WEBVTT\n\n00:01.000 --> 00:02.000 line:0\nHello\n",
+		},
+		{
+			name:    "malformed timing",
+			input:   "1\n00:00:01 --> 00:00:02\nHello\n",
+			wantErr: true,
+		},
+		{
+			name:    "minutes past 59",
+			input:   "1\n00:60:01,000 --> 00:61:02,000\nHello\n",
+			wantErr: true,
+		},
+		{
+			name:    "no cues",
+			input:   "just some text\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := convertCaptionsToWebVTT([]byte(tc.input))
+			if tc.wantErr {
+				if !errors.Is(err, errInvalidCaptions) {
+					t.Errorf("convertCaptionsToWebVTT() error = %v, want errInvalidCaptions", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertCaptionsToWebVTT() error = %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("convertCaptionsToWebVTT() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,36 +3,63 @@ package main
 import (
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
 // CH6 L6 (Step 5)
 // It should take a video database.Video as input and return a database.Video with the VideoURL field set
 // to a presigned URL and an error (to be returned from the handler)
+// Caption tracks, the hover preview, the audio rendition and storyboard sheets are stored the same way and get presigned too.
 func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
-	
-	if video.VideoURL == nil {
-		return video, fmt.Errorf("No bucket/key.")
+
+	captions := make([]database.Caption, 0, len(video.Captions))
+	for _, caption := range video.Captions {
+		presignedUrl, err := cfg.presignStorageLocation(caption.CaptionURL)
+		if err != nil {
+			return video, err
+		}
+		caption.CaptionURL = presignedUrl
+		captions = append(captions, caption)
+	}
+	video.Captions = captions
+
+	if video.PreviewURL != nil {
+		presignedUrl, err := cfg.presignStorageLocation(*video.PreviewURL)
+		if err != nil {
+			return video, err
+		}
+		video.PreviewURL = &presignedUrl
 	}
 
-	// It should first split the video.VideoURL on the comma to get the bucket and key
-	sep := strings.Split(*video.VideoURL, ",")
-	if len(sep) != 2 {
-		return video, fmt.Errorf("No bucket/key.")
+	if video.Audio != nil {
+		audio, err := cfg.signAudio(*video.Audio)
+		if err != nil {
+			return video, err
+		}
+		video.Audio = &audio
 	}
-		
-	bucket := sep[0]
-	key := sep[1]
 
-	// Then it should use generatePresignedURL to get a presigned URL for the video
-	presignedUrl, err := generatePresignedURL(cfg.s3Client, bucket, key, time.Duration(5 * time.Minute))
+	if video.Storyboard != nil {
+		storyboard, err := cfg.signStoryboard(video.ID, *video.Storyboard)
+		if err != nil {
+			return video, err
+		}
+		video.Storyboard = &storyboard
+	}
+
+	// Drafts don't have a video file yet
+	if video.VideoURL == nil {
+		return video, nil
+	}
+
+	presignedUrl, err := cfg.presignStorageLocation(*video.VideoURL)
 	if err != nil {
 		return video, err
 	}
-	
+
 	// Set the VideoURL field of the video to the presigned URL and return the updated video
 	video.VideoURL = &presignedUrl
 
@@ -41,3 +68,44 @@ func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video
 	return video, nil
 
 }
+
+// Splits a stored "bucket,key" location and uses generatePresignedURL on it
+func (cfg *apiConfig) presignStorageLocation(location string) (string, error) {
+	bucket, key, err := parseStorageLocation(location)
+	if err != nil {
+		return "", err
+	}
+	return generatePresignedURL(cfg.s3Client, bucket, key, time.Duration(5*time.Minute))
+}
+
+func (cfg *apiConfig) signAudio(audio database.AudioRendition) (database.AudioRendition, error) {
+	presignedUrl, err := cfg.presignStorageLocation(audio.AudioURL)
+	if err != nil {
+		return audio, err
+	}
+	audio.AudioURL = presignedUrl
+	return audio, nil
+}
+
+// Presigns every sprite sheet of the storyboard. The WebVTT index can't be
+// served from S3 as is (its relative sprite names would lose the signature),
+// so clients get the API endpoint that renders it with presigned URLs.
+func (cfg *apiConfig) signStoryboard(videoID uuid.UUID, storyboard database.Storyboard) (database.Storyboard, error) {
+	bucket, prefix, err := parseStorageLocation(storyboard.StoryboardURL)
+	if err != nil {
+		return storyboard, err
+	}
+
+	storyboard.SpriteURLs = make([]string, 0, storyboard.SheetCount)
+	for sheet := 0; sheet < storyboard.SheetCount; sheet++ {
+		key := prefix + "/" + storyboardSpriteName(sheet)
+		presignedUrl, err := generatePresignedURL(cfg.s3Client, bucket, key, time.Duration(5*time.Minute))
+		if err != nil {
+			return storyboard, err
+		}
+		storyboard.SpriteURLs = append(storyboard.SpriteURLs, presignedUrl)
+	}
+	storyboard.VTTURL = fmt.Sprintf("/api/videos/%s/storyboard.vtt", videoID)
+
+	return storyboard, nil
+}
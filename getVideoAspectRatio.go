@@ -1,50 +1,19 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"os/exec"
 )
 
-type ffprobe struct {
-	Streams	 []stream `json:"streams"`
-}
-
-type stream struct {
-	Index		int `json:"index"`
-	CodecType	string `json:"codec_type"`
-	Width		int `json:"width"`
-	Height	 	int `json:"height"`
-}
-
 // CH4 L3
 // Takes a file path and returns the aspect ratio as a string.
-func getVideoAspectRatio(filePath string) (string, error) {
-	// It should use exec.Command to run the same ffprobe command as above.
-	// In this case, the command is ffprobe and the arguments are
-	// -v, error, -print_format, json, -show_streams, and the file path.
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-
-	// Set the resulting exec.Cmd's Stdout field to a pointer to a new bytes.Buffer.
-	var out bytes.Buffer
-	cmd.Stdout = &out
-
-	// .Run() the command
-	err := cmd.Run()
+func (cfg *apiConfig) getVideoAspectRatio(ctx context.Context, filePath string) (string, error) {
+	// ffprobe -v error -print_format json -show_streams, through the media runner
+	data, err := cfg.media.Probe(ctx, filePath)
 	if err != nil {
 		return "other", err
 	}
 
-	// Unmarshal the stdout of the command from the buffer's .Bytes
-	// into a JSON struct so that you can get the width and height fields.
-	data := ffprobe{}
-	err = json.Unmarshal(out.Bytes(), &data)
-	if err != nil {
-		fmt.Printf("error unmarshalling ffprobe output")
-		return "other", err
-	}
-
 	for _, stream := range data.Streams {
 		if stream.CodecType == "video" {
 			// I did a bit of math to determine the ratio,
@@ -67,4 +36,18 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	
 	return "other", nil
 
-}
\ No newline at end of file
+}
+
+// Returns the width and height of the first video stream
+func (cfg *apiConfig) getVideoDimensions(ctx context.Context, filePath string) (int, int, error) {
+	data, err := cfg.media.Probe(ctx, filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stream, ok := data.VideoStream()
+	if !ok || stream.Width <= 0 || stream.Height <= 0 {
+		return 0, 0, fmt.Errorf("no video stream in %s", filePath)
+	}
+	return stream.Width, stream.Height, nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"context"
+)
+
+// Returns the duration of the container in seconds, as reported by ffprobe
+func (cfg *apiConfig) getVideoDuration(ctx context.Context, filePath string) (float64, error) {
+	data, err := cfg.media.Probe(ctx, filePath)
+	if err != nil {
+		return 0, err
+	}
+	return data.Duration()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Largest page GET /admin/audit-events returns
+const maxAuditPageSize = 1000
+
+// GET /admin/audit-events lists audit events, newest first. Query
+// parameters:
+//
+//	action       one action, like login_failed or video_delete
+//	actor_id     the user who did it
+//	target_type  user or video
+//	target_id    what it was done to
+//	since        RFC 3339 time or YYYY-MM-DD, inclusive
+//	until        RFC 3339 time or YYYY-MM-DD, exclusive
+//	limit        page size, 100 by default, at most 1000
+//	before_id    next_before_id of the previous page
+func (cfg *apiConfig) handlerAuditEventsList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Events       []database.AuditEvent `json:"events"`
+		NextBeforeID *int64                `json:"next_before_id"`
+	}
+
+	if _, ok := cfg.authorizeAdmin(w, r); !ok {
+		return
+	}
+
+	filter, err := parseAuditEventFilter(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	filter.Limit = database.DefaultAuditPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxAuditPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize), err)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("before_id"); value != "" {
+		filter.BeforeID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || filter.BeforeID < 1 {
+			respondWithError(w, http.StatusBadRequest, "before_id must be an event ID", err)
+			return
+		}
+	}
+
+	// One extra event says whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	events, err := cfg.db.GetAuditEvents(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve audit events", err)
+		return
+	}
+
+	resp := response{Events: events}
+	if len(events) > limit {
+		resp.Events = events[:limit]
+		resp.NextBeforeID = &resp.Events[limit-1].ID
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// GET /admin/audit-events/export streams every matching event, oldest
+// first, as newline delimited JSON. It takes the filters of
+// handlerAuditEventsList.
+func (cfg *apiConfig) handlerAuditEventsExport(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.authorizeAdmin(w, r); !ok {
+		return
+	}
+
+	filter, err := parseAuditEventFilter(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	filter.Limit = -1
+	filter.Oldest = true
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-events.ndjson"`)
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	err = cfg.db.EachAuditEvent(filter, func(event database.AuditEvent) error {
+		err := encoder.Encode(event)
+		if err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%100 == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && written == 0 {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export audit events", err)
+		return
+	}
+	if err != nil {
+		// Too late for an error status, the export just ends early
+		log.Printf("Couldn't finish audit event export after %d events: %v\n", written, err)
+	}
+}
+
+func parseAuditEventFilter(query url.Values) (database.AuditEventFilter, error) {
+	filter := database.AuditEventFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+	}
+
+	if value := query.Get("actor_id"); value != "" {
+		actorID, err := uuid.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("actor_id must be a user ID")
+		}
+		filter.ActorID = &actorID
+	}
+
+	var err error
+	filter.Since, err = parseTimeParam(query, "since")
+	if err != nil {
+		return filter, err
+	}
+	filter.Until, err = parseTimeParam(query, "until")
+	if err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxCaptionSize = 2 << 20
+
+func (cfg *apiConfig) handlerCaptionsList(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil || video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+
+	video, err = cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get presigned caption url", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video.Captions)
+}
+
+func (cfg *apiConfig) handlerCaptionUpload(w http.ResponseWriter, r *http.Request) {
+	cfg.storeCaption(w, r, false)
+}
+
+func (cfg *apiConfig) handlerCaptionReplace(w http.ResponseWriter, r *http.Request) {
+	cfg.storeCaption(w, r, true)
+}
+
+// Handles both upload (POST, the language must be new) and replace (PUT,
+// the language must already have a track). SRT is converted to WebVTT
+// before it is stored.
+func (cfg *apiConfig) storeCaption(w http.ResponseWriter, r *http.Request, replace bool) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	language := r.PathValue("language")
+	if !captionLanguagePattern.MatchString(language) {
+		respondWithError(w, http.StatusBadRequest, "Invalid language tag", nil)
+		return
+	}
+
+	existing, err := cfg.db.GetCaption(video.ID, language)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get caption", err)
+		return
+	}
+	if replace && existing == nil {
+		respondWithError(w, http.StatusNotFound, "No caption track for this language", nil)
+		return
+	}
+	if !replace && existing != nil {
+		respondWithError(w, http.StatusConflict, "Caption track already exists, use PUT to replace it", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCaptionSize+(1<<10))
+	file, _, err := r.FormFile("caption")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxCaptionSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to read caption file", err)
+		return
+	}
+	if len(data) > maxCaptionSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Caption file is too large", nil)
+		return
+	}
+
+	webVTT, err := convertCaptionsToWebVTT(data)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Caption file must be SRT or WebVTT", err)
+		return
+	}
+
+	label := r.FormValue("label")
+	if label == "" {
+		label = language
+	}
+
+	s3Key := fmt.Sprintf("captions/%s/%s.vtt", video.ID, language)
+	location, err := cfg.putObject(r.Context(), s3Key, "text/vtt", bytes.NewReader(webVTT))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to copy caption to S3", err)
+		return
+	}
+
+	caption, err := cfg.db.UpsertCaption(database.Caption{
+		VideoID:    video.ID,
+		Language:   language,
+		Label:      label,
+		CaptionURL: location,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save caption", err)
+		return
+	}
+
+	caption.CaptionURL, err = cfg.presignStorageLocation(caption.CaptionURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get presigned caption url", err)
+		return
+	}
+
+	status := http.StatusCreated
+	if replace {
+		status = http.StatusOK
+	}
+	respondWithJSON(w, status, caption)
+}
+
+func (cfg *apiConfig) handlerCaptionDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	language := r.PathValue("language")
+	caption, err := cfg.db.GetCaption(video.ID, language)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get caption", err)
+		return
+	}
+	if caption == nil {
+		respondWithError(w, http.StatusNotFound, "No caption track for this language", nil)
+		return
+	}
+
+	err = cfg.deleteObject(r.Context(), caption.CaptionURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete caption from S3", err)
+		return
+	}
+
+	err = cfg.db.DeleteCaption(video.ID, language)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete caption", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
@@ -36,6 +37,12 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 
 	err = auth.CheckPasswordHash(params.Password, user.Password)
 	if err != nil {
+		// Unknown emails have no user to target, the email says who was tried
+		targetID := ""
+		if user.ID != uuid.Nil {
+			targetID = user.ID.String()
+		}
+		cfg.audit(r, database.AuditLoginFailed, nil, database.AuditTargetUser, targetID, map[string]string{"email": params.Email})
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
@@ -66,6 +73,7 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cfg.audit(r, database.AuditLogin, &user.ID, database.AuditTargetUser, user.ID.String(), nil)
 	respondWithJSON(w, http.StatusOK, response{
 		User:         user,
 		Token:        accessToken,
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type playlistParameters struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Visibility  *string `json:"visibility"`
+}
+
+// Checks the parameters, private being the default visibility
+func (params playlistParameters) validate() (string, error) {
+	if params.Title == "" {
+		return "", errors.New("title is required")
+	}
+	if params.Visibility == nil {
+		return database.PlaylistPrivate, nil
+	}
+	if !database.ValidPlaylistVisibility(*params.Visibility) {
+		return "", errors.New("visibility must be private, unlisted or public")
+	}
+	return *params.Visibility, nil
+}
+
+// POST /api/playlists creates an empty playlist.
+func (cfg *apiConfig) handlerPlaylistCreate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := playlistParameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	visibility, err := params.validate()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	playlist, err := cfg.db.CreatePlaylist(database.CreatePlaylistParams{
+		UserID:      userID,
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  visibility,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playlist", err)
+		return
+	}
+
+	cfg.respondWithPlaylist(w, http.StatusCreated, playlist)
+}
+
+// GET /api/playlists lists the caller's playlists without their videos.
+func (cfg *apiConfig) handlerPlaylistsList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	playlists, err := cfg.db.GetPlaylists(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+// GET /api/users/{userID}/playlists lists a user's public playlists
+// without their videos. It doesn't need a JWT.
+func (cfg *apiConfig) handlerPublicPlaylistsList(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	playlists, err := cfg.db.GetPublicPlaylists(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+// GET /api/playlists/{playlistID} returns the playlist with its videos in
+// order. Unlisted and public playlists don't need a JWT; private ones are
+// only found by their owner.
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return
+	}
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	if playlist.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+		return
+	}
+	if playlist.Visibility == database.PlaylistPrivate {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+			return
+		}
+		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil || userID != playlist.UserID {
+			respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+			return
+		}
+	}
+
+	cfg.respondWithPlaylist(w, http.StatusOK, playlist)
+}
+
+// PUT /api/playlists/{playlistID} replaces the title, description and
+// visibility.
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := playlistParameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	visibility, err := params.validate()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	playlist.Title = params.Title
+	playlist.Description = params.Description
+	playlist.Visibility = visibility
+	err = cfg.db.UpdatePlaylist(playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playlist", err)
+		return
+	}
+
+	cfg.respondWithPlaylistByID(w, playlist.ID)
+}
+
+// DELETE /api/playlists/{playlistID} deletes the playlist. Its videos are
+// left alone.
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeletePlaylist(playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete playlist", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/playlists/{playlistID}/videos adds one of the caller's videos,
+// at the end unless a position (counted from 0) is given.
+func (cfg *apiConfig) handlerPlaylistVideoAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID  uuid.UUID `json:"video_id"`
+		Position *int      `json:"position"`
+	}
+
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	position := playlist.VideoCount
+	if params.Position != nil {
+		if *params.Position < 0 {
+			respondWithError(w, http.StatusBadRequest, "Position can't be negative", nil)
+			return
+		}
+		position = *params.Position
+	}
+
+	video, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.UserID != playlist.UserID {
+		respondWithError(w, http.StatusForbidden, "User is not the video owner", nil)
+		return
+	}
+
+	err = cfg.db.AddPlaylistVideo(playlist.ID, video.ID, position)
+	if errors.Is(err, database.ErrVideoInPlaylist) {
+		respondWithError(w, http.StatusConflict, "Video is already in the playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add video", err)
+		return
+	}
+
+	cfg.respondWithPlaylistByID(w, playlist.ID)
+}
+
+// DELETE /api/playlists/{playlistID}/videos/{videoID} takes a video out
+// of the playlist.
+func (cfg *apiConfig) handlerPlaylistVideoRemove(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	err = cfg.db.RemovePlaylistVideo(playlist.ID, videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove video", err)
+		return
+	}
+
+	cfg.respondWithPlaylistByID(w, playlist.ID)
+}
+
+// PUT /api/playlists/{playlistID}/videos sets the order of the playlist,
+// given every video ID in it once.
+func (cfg *apiConfig) handlerPlaylistReorder(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs []uuid.UUID `json:"video_ids"`
+	}
+
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.ReorderPlaylist(playlist.ID, params.VideoIDs)
+	if errors.Is(err, database.ErrPlaylistOrder) {
+		respondWithError(w, http.StatusBadRequest, "video_ids must list every video of the playlist once", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reorder playlist", err)
+		return
+	}
+
+	cfg.respondWithPlaylistByID(w, playlist.ID)
+}
+
+func (cfg *apiConfig) respondWithPlaylistByID(w http.ResponseWriter, playlistID uuid.UUID) {
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	cfg.respondWithPlaylist(w, http.StatusOK, playlist)
+}
+
+// Responds with the playlist and its videos, presigned like
+// handlerVideosRetrieve does
+func (cfg *apiConfig) respondWithPlaylist(w http.ResponseWriter, code int, playlist database.Playlist) {
+	type response struct {
+		database.Playlist
+		Videos []database.Video `json:"videos"`
+	}
+
+	videos, err := cfg.db.GetPlaylistVideos(playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlist videos", err)
+		return
+	}
+	for i := range videos {
+		videos[i], err = cfg.dbVideoToSignedVideo(videos[i])
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to get presigned video url", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, code, response{Playlist: playlist, Videos: videos})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Comment lines sent while nothing happens, so proxies don't drop the stream
+const progressHeartbeat = 15 * time.Second
+
+// How long a progress token can be used to connect. EventSource reconnects
+// with the same URL when the stream drops, so it outlasts the first
+// connection.
+const progressTokenLifetime = 10 * time.Minute
+
+// POST /api/videos/{videoID}/progress-token issues a token for
+// GET /api/videos/{videoID}/progress?token=, which only works for that
+// video's progress and expires after progressTokenLifetime.
+func (cfg *apiConfig) handlerVideoProgressToken(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := auth.MakeProgressToken(video.UserID, video.ID, cfg.jwtSecret, progressTokenLifetime)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create progress token", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Token:     token,
+		ExpiresAt: time.Now().UTC().Add(progressTokenLifetime),
+	})
+}
+
+// GET /api/videos/{videoID}/progress streams the progress of the video's
+// upload as Server-Sent Events, until it completes or fails. EventSource
+// can't set headers, so it passes a token from
+// POST /api/videos/{videoID}/progress-token as ?token= instead of the JWT.
+// With ?upload_id= it waits for the upload sent with the same ID, instead
+// of reporting the one before it.
+func (cfg *apiConfig) handlerVideoProgress(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	var userID uuid.UUID
+	if token := r.URL.Query().Get("token"); token != "" {
+		userID, err = auth.ValidateProgressToken(token, cfg.jwtSecret, videoID)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate progress token", err)
+			return
+		}
+	} else {
+		var ok bool
+		userID, ok = cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	video, ok := cfg.authorizeVideoOwnerID(w, videoID, userID)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming unsupported", nil)
+		return
+	}
+
+	events, unsubscribe := cfg.progress.Subscribe(video.ID, r.URL.Query().Get("upload_id"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(progressHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			name := "progress"
+			if event.Done() {
+				name = string(event.Stage)
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+			flusher.Flush()
+			if event.Done() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// GET /api/me/usage reports what the caller's videos take up and the
+// limits that apply to them.
+func (cfg *apiConfig) handlerUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	quota, err := cfg.quotaFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, quota)
+}
+
+// GET /admin/users/{userID}/quota
+func (cfg *apiConfig) handlerUserQuotaGet(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	cfg.respondWithUserQuota(w, userID)
+}
+
+// PUT /admin/users/{userID}/quota sets the user's overrides. Limits left
+// out (or null) fall back to the deployment's defaults, 0 is unlimited.
+func (cfg *apiConfig) handlerUserQuotaUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MaxBytes           *int64   `json:"max_bytes"`
+		MaxVideos          *int     `json:"max_videos"`
+		MaxDurationSeconds *float64 `json:"max_duration_seconds"`
+	}
+
+	_, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if (params.MaxBytes != nil && *params.MaxBytes < 0) ||
+		(params.MaxVideos != nil && *params.MaxVideos < 0) ||
+		(params.MaxDurationSeconds != nil && *params.MaxDurationSeconds < 0) {
+		respondWithError(w, http.StatusBadRequest, "Limits can't be negative", nil)
+		return
+	}
+
+	_, err = cfg.db.UpsertUserQuota(database.UserQuota{
+		UserID:             userID,
+		MaxBytes:           params.MaxBytes,
+		MaxVideos:          params.MaxVideos,
+		MaxDurationSeconds: params.MaxDurationSeconds,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save quota", err)
+		return
+	}
+	cfg.respondWithUserQuota(w, userID)
+}
+
+// DELETE /admin/users/{userID}/quota puts the user back on the defaults
+func (cfg *apiConfig) handlerUserQuotaDelete(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteUserQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete quota", err)
+		return
+	}
+	cfg.respondWithUserQuota(w, userID)
+}
+
+func (cfg *apiConfig) respondWithUserQuota(w http.ResponseWriter, userID uuid.UUID) {
+	type response struct {
+		quotaStatus
+		Override *database.UserQuota `json:"override"`
+	}
+
+	quota, err := cfg.quotaFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	override, err := cfg.db.GetUserQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get quota", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{quotaStatus: quota, Override: override})
+}
+
+// Checks the caller is an admin and parses the {userID} they act on.
+// On failure the error response has already been written.
+func (cfg *apiConfig) adminTargetUser(w http.ResponseWriter, r *http.Request) (adminID, userID uuid.UUID, ok bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	adminID, ok = cfg.authorizeAdmin(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", nil)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return adminID, userID, true
+}
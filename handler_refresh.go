@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +25,10 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
 	}
+	if user == nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", nil)
+		return
+	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
@@ -34,6 +40,7 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cfg.audit(r, database.AuditTokenRefresh, &user.ID, database.AuditTargetUser, user.ID.String(), nil)
 	respondWithJSON(w, http.StatusOK, response{
 		Token: accessToken,
 	})
@@ -46,11 +53,22 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	token, err := cfg.db.GetRefreshToken(refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get session", err)
+		return
+	}
+
 	err = cfg.db.RevokeRefreshToken(refreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
 	}
 
+	// Unknown tokens revoke nothing; the token itself never goes in the log
+	if token.UserID != uuid.Nil {
+		cfg.audit(r, database.AuditTokenRevoke, &token.UserID, database.AuditTargetUser, token.UserID.String(), nil)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
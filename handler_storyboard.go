@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Serves the storyboard's WebVTT thumbnails track with every sprite sheet
+// replaced by a presigned URL, ready for the player.
+func (cfg *apiConfig) handlerStoryboardVTT(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.Storyboard == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no storyboard", nil)
+		return
+	}
+
+	storyboard, err := cfg.signStoryboard(video.ID, *video.Storyboard)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get presigned storyboard urls", err)
+		return
+	}
+
+	vtt := buildStoryboardVTT(storyboard, func(sheet int) string {
+		return storyboard.SpriteURLs[sheet]
+	})
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(vtt))
+}
@@ -9,9 +9,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -38,6 +38,13 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 
 	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
 
+	if !cfg.acceptMediaWork(w) {
+		return
+	}
+	if !cfg.checkScratchSpace(w, r.ContentLength) {
+		return
+	}
+
 	// CH1 L05
 	// 1. Authentication has already been taken care of for you, and the video's ID has been parsed from the URL path.
 	// 2. Parse the form 
@@ -62,6 +69,10 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "User is not the video owner", err)
 		return
 	}
+	if videoMetadata.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Video is in the trash", nil)
+		return
+	}
 
 	// CH1 L8
 	// Use the mime.ParseMediaType function to get the media type from the Content-Type header
@@ -86,49 +97,57 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	randomName := base64.URLEncoding.EncodeToString(key)
 	fmt.Printf("randomName       : %s\n", randomName)
 
-	// CH1 L7
-	// Let's update our handler to store the files on the file system. We'll save uploaded files to the /assets directory on disk.
-
-	// 1. Instead of encoding to base64, update the handler to save the bytes to a file at the path /assets/<videoID>.<file_extension>.
-	// 1.1 Use the Content-Type header to determine the file extension.
-	// Per exemple "image/png"
-	file_extension := strings.Split(mediatype, "/")[1]
-	fmt.Printf("file_extension   : %s\n", file_extension)
-	
-	// 1.2 Use the videoID to create a unique file path. filepath.Join and cfg.assetsRoot will be helpful here.
-	filename := fmt.Sprintf("%v.%s", randomName, file_extension)
-	completeFilepath := filepath.Join(cfg.assetsRoot, filename)
-	fmt.Printf("filename         : %s\n", filename)
-	fmt.Printf("completeFilepath : %s\n", completeFilepath)
-
-	// 1.3 Use os.Create to create the new file
-	newFile, err := os.Create(completeFilepath)
+	// Save the upload to a temp file so ffmpeg can decode it. The original
+	// bytes are never served: only the re-encoded renditions are.
+	jobDir, err := cfg.scratch.Job("thumbnail")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
+		return
+	}
+	defer os.RemoveAll(jobDir)
+
+	tempFile, err := os.Create(filepath.Join(jobDir, "thumbnail"))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to create file ", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
 		return
 	}
+	defer tempFile.Close()
 
-	// 1.4 Copy the contents from the multipart.File to the new file on disk using io.Copy
-	_, err = io.Copy(newFile, file)
+	_, err = io.Copy(tempFile, file)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Unable to copy file ", err)
 		return
 	}
 
-	// 2. Update the thumbnail_url. Notice that in main.go we have a file server that serves files from the /assets directory.
-	// The URL for the thumbnail should now be:
-	// http://localhost:<port>/assets/<videoID>.<file_extension>
-	thumbnailURL := fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, filename)
-	videoMetadata.ThumbnailURL = &thumbnailURL
-	err = cfg.db.UpdateVideo(videoMetadata)
+	renditions, err := cfg.processThumbnail(r.Context(), tempFile.Name(), cfg.assetsRoot, randomName)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to update video ", err)
+		respondWithMediaError(w, http.StatusBadRequest, "Unable to process thumbnail", err)
 		return
 	}
 
+	thumbnails := []database.Thumbnail{}
+	for _, rendition := range renditions {
+		thumbnails = append(thumbnails, database.Thumbnail{
+			URL:      cfg.assetURL(filepath.Base(rendition.path)),
+			Width:    rendition.width,
+			MimeType: rendition.mimeType,
+		})
+	}
+
+	err = cfg.db.ReplaceVideoThumbnails(videoID, thumbnails)
+	if err != nil {
+		removeThumbnailRenditions(renditions)
+		respondWithError(w, http.StatusInternalServerError, "Unable to update video ", err)
+		return
+	}
+
+	// The renditions replace the legacy single thumbnail, if there was one
+	cfg.removeAssets(videoMetadata.Thumbnails)
+	cfg.audit(r, database.AuditVideoThumbnail, &userID, database.AuditTargetVideo, videoID.String(), nil)
+
 	// Restart the server and re-upload the boots-image-horizontal.png thumbnail image to ensure it's working.
 	// You should see it in the UI as well as a copy in the /assets directory.
 
 	// 8. Respond with updated JSON of the video's metadata. Use the provided respondWithJSON function and pass it the updated database.Video struct to marshal.
-	respondWithJSON(w, http.StatusOK, struct{}{})
+	cfg.respondWithVideo(w, videoID)
 }
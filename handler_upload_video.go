@@ -4,16 +4,21 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"io"
 	"fmt"
 	"log"
 	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -25,8 +30,7 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	// 1. Set an upload limit of 1 GB (1 << 30 bytes) using http.MaxBytesReader.
 	// func MaxBytesReader(w ResponseWriter, r io.ReadCloser, n int64) io.ReadCloser
-	//const uploadLimit = 1 << 30
-	//limit := MaxBytesReader(w, ?, 1 << 30)
+	// (applied below, once we know whose quota the upload counts against)
 	
 	// 2. Extract the videoID from the URL path parameters and parse it as a UUID
 	// Copiat de handlerUploadThumbnail
@@ -58,7 +62,42 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	if video.UserID != userID {
 		respondWithError(w, http.StatusUnauthorized, "User is not the video owner", err)
 		return
-	}	
+	}
+	if video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Video is in the trash", nil)
+		return
+	}
+
+	if !cfg.acceptMediaWork(w) {
+		return
+	}
+	if !cfg.checkScratchSpace(w, r.ContentLength*scratchSpacePerUploadByte) {
+		return
+	}
+
+	// Quotas are checked on what is sent, and again on what will be stored
+	quota, err := cfg.quotaFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	if remaining := quota.remainingBytes(); remaining >= 0 && r.ContentLength > remaining+uploadFormOverhead {
+		respondStorageQuotaExceeded(w, quota, r.ContentLength)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, quota.uploadLimit())
+
+	// Progress is published for GET /api/videos/{videoID}/progress, to
+	// the listeners that passed the same ?upload_id= or none. Any return
+	// before the end of the handler is a failed upload.
+	tracker := cfg.trackUpload(videoID, r.URL.Query().Get("upload_id"))
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			tracker.failed("Upload failed")
+		}
+	}()
+	r.Body = newCountingReader(r.Body, r.ContentLength, tracker.receiving)
 
 	// 5. Parse the uploaded video file from the form data
 	// Use (http.Request).FormFile with the key "video" to get a multipart.File in memory
@@ -66,10 +105,22 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	// Adaptat de handlerUploadThumbnail
 	file, header, err := r.FormFile("video")
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr) && quota.uploadLimit() < maxUploadBytes+uploadFormOverhead:
+			respondStorageQuotaExceeded(w, quota, r.ContentLength)
+		case errors.As(err, &maxBytesErr):
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Video is larger than 1 GB", err)
+		default:
+			respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		}
 		return
 	}
 	defer file.Close()
+	if !quota.allowsBytes(header.Size) {
+		respondStorageQuotaExceeded(w, quota, header.Size)
+		return
+	}
 
 	// 6. Validate the uploaded file to ensure it's an MP4 video
 	// Use mime.ParseMediaType and "video/mp4" as the MIME type
@@ -81,6 +132,38 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Loudness normalisation follows the deployment default unless the
+	// upload asks for something else with normalize_audio=true/false
+	normalizeAudio := cfg.loudnessNormalize
+	if value := r.FormValue("normalize_audio"); value != "" {
+		normalizeAudio, err = strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid normalize_audio value", err)
+			return
+		}
+	}
+
+	// Same for the audio-only rendition, with extract_audio=true/false
+	extractAudio := cfg.audioRendition
+	if value := r.FormValue("extract_audio"); value != "" {
+		extractAudio, err = strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid extract_audio value", err)
+			return
+		}
+	}
+
+	// Location, device and other metadata is stripped unless the upload
+	// opts out with keep_metadata=true
+	keepMetadata := false
+	if value := r.FormValue("keep_metadata"); value != "" {
+		keepMetadata, err = strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid keep_metadata value", err)
+			return
+		}
+	}
+
 	// 7. Save the uploaded file to a temporary file on disk.
 	// Use os.CreateTemp to create a temporary file.
 	// I passed in an empty string for the directory to use the system default,
@@ -88,12 +171,22 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	// defer remove the temp file with os.Remove
 	// defer close the temp file (defer is LIFO, so it will close before the remove)
 	// io.Copy the contents over from the wire to the temp file
-	tempFile, err := os.CreateTemp("", "tubely-upload.mp4")
+	// The temp file, and every file ffmpeg derives from it, lives in a
+	// scratch job dir that is removed however the handler returns
+	jobDir, err := cfg.scratch.Job("upload")
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to save file", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to save file", err)
 		return
 	}
-	
+	defer os.RemoveAll(jobDir)
+
+	tempFile, err := os.Create(filepath.Join(jobDir, "upload.mp4"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to save file", err)
+		return
+	}
+	defer tempFile.Close()
+
 	log.Printf("Creating temp file %s\n", tempFile.Name())
 
 	_, err = io.Copy(tempFile, file)
@@ -104,9 +197,49 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
  
 	// CH5 L2
 	// Create a processed version of the video. Upload the processed video to S3, and discard the original.
-	processedFileName, err := processVideoForFastStart(tempFile.Name())
+	duration, err := cfg.getVideoDuration(r.Context(), tempFile.Name())
+	if err != nil {
+		respondWithMediaError(w, http.StatusBadRequest, "Unable to read video", err)
+		return
+	}
+	if !quota.allowsDuration(duration) {
+		respondDurationQuotaExceeded(w, quota, duration)
+		return
+	}
+
+	sourceFileName := tempFile.Name()
+	var loudness *database.Loudness
+	if normalizeAudio {
+		ctx := tracker.processing(r.Context(), "loudnorm", duration)
+		normalizedFileName, measured, err := cfg.processVideoLoudness(ctx, sourceFileName, cfg.loudnessTargetLUFS)
+		switch {
+		case errors.Is(err, errNoAudioStream), errors.Is(err, errSilentAudio):
+			log.Printf("Skipping loudness normalisation for %s: %v\n", videoID, err)
+		case err != nil:
+			respondWithMediaError(w, http.StatusBadRequest, "Unable to normalize audio", err)
+			return
+		default:
+			defer os.Remove(normalizedFileName)
+			sourceFileName = normalizedFileName
+			loudness = &measured
+		}
+	}
+
+	var metadataArgs, strippedMetadata []string
+	if !keepMetadata {
+		metadataArgs, strippedMetadata, err = cfg.stripMetadataArgs(r.Context(), sourceFileName)
+		if err != nil {
+			respondWithMediaError(w, http.StatusBadRequest, "Unable to read video metadata", err)
+			return
+		}
+		if len(strippedMetadata) > 0 {
+			log.Printf("Stripping metadata of %s: %v\n", videoID, strippedMetadata)
+		}
+	}
+
+	processedFileName, err := cfg.processVideoForFastStart(tracker.processing(r.Context(), "faststart", duration), sourceFileName, metadataArgs...)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to process video ", err)
+		respondWithMediaError(w, http.StatusBadRequest, "Unable to process video ", err)
 		log.Printf(err.Error())
 		return
 	}
@@ -125,7 +258,7 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	os.Remove(tempFile.Name())
 
 	// CH4 L3
-	aspectRatio, err := getVideoAspectRatio(processedFile.Name())
+	aspectRatio, err := cfg.getVideoAspectRatio(r.Context(), processedFile.Name())
 	var prefix string
 	switch aspectRatio {
 		case "16:9": 
@@ -155,21 +288,101 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	s3Key := fmt.Sprintf("%s/%s", prefix, randomKey)
 
+	// With a watermark the watermarked copy is served and the processed
+	// upload is kept, untouched, under originals/
+	uploadFile := processedFile
+	servedFileName := processedFile.Name()
+	var originalVideoURL *string
+	watermark, err := cfg.watermarkFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+	if watermark != nil {
+		watermarkedFileName, err := cfg.processVideoWatermark(tracker.processing(r.Context(), "watermark", duration), processedFile.Name(), *watermark)
+		if err != nil {
+			respondWithMediaError(w, http.StatusInternalServerError, "Unable to watermark video", err)
+			return
+		}
+		defer os.Remove(watermarkedFileName)
+
+		watermarkedFile, err := os.Open(watermarkedFileName)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to open watermarked video", err)
+			return
+		}
+		defer watermarkedFile.Close()
+
+		uploadFile = watermarkedFile
+		servedFileName = watermarkedFileName
+	}
+
+	// Processing changes the size, so check the quota against what will
+	// actually be stored: the served file and the original, if kept
+	uploadInfo, err := uploadFile.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read processed video", err)
+		return
+	}
+	sizeBytes := uploadInfo.Size()
+	if uploadFile != processedFile {
+		processedInfo, err := processedFile.Stat()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to read processed video", err)
+			return
+		}
+		sizeBytes += processedInfo.Size()
+	}
+	quota, err = cfg.quotaFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	if !quota.allowsBytes(sizeBytes) {
+		respondStorageQuotaExceeded(w, quota, sizeBytes)
+		return
+	}
+
+	if uploadFile != processedFile {
+		originalLocation, err := cfg.putObject(r.Context(), "originals/"+s3Key, mediatype, processedFile)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Unable to copy original to S3", err)
+			return
+		}
+		originalVideoURL = &originalLocation
+	}
+
 	s3Params := s3.PutObjectInput{
 		Bucket: &cfg.s3Bucket,
 		Key: &s3Key,
-		Body: processedFile,
+		Body: newCountingReader(uploadFile, uploadInfo.Size(), tracker.uploading),
 		ContentType: &mediatype,
 	}
 
 	// Retorna un PutObjectOutput que (de moment?) ignorem
 	// https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/s3#PutObjectOutput
-	_, err = cfg.s3Client.PutObject(r.Context(), &s3Params)
+	// An unsigned payload lets the SDK read the body once, as it is sent,
+	// instead of hashing it first, so the upload percentage is real
+	_, err = cfg.s3Client.PutObject(r.Context(), &s3Params, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
 	if err != nil {
+		if originalVideoURL != nil {
+			// Nothing refers to the original yet. The upload may have
+			// failed because the client left, so don't use its context.
+			if err := cfg.deleteObject(context.WithoutCancel(r.Context()), *originalVideoURL); err != nil {
+				log.Printf("Couldn't delete original %s: %v\n", *originalVideoURL, err)
+			}
+		}
 		respondWithError(w, http.StatusBadRequest, "Unable to copy file to S3", err)
 		return
 	}
 
+	previewURL := cfg.uploadPreview(r.Context(), videoID, servedFileName, s3Key)
+	storyboard := cfg.uploadStoryboard(r.Context(), videoID, servedFileName, s3Key)
+	var audio *database.AudioRendition
+	if extractAudio {
+		audio = cfg.uploadAudio(r.Context(), videoID, servedFileName, s3Key)
+	}
+
 	// CH6 L6 (Step 4)
 	// Store bucket and key as a comma delimited string in the video_url. E.g. tube-private-12345,portrait/vertical.mp4
 	videoURL := fmt.Sprintf("%s,%s", cfg.s3Bucket, s3Key)
@@ -179,13 +392,40 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	// S3 URLs are in the format https://<bucket-name>.s3.<region>.amazonaws.com/<key>.
 	// Make sure you use the correct region and bucket name!
 	// videoURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.s3Bucket, cfg.s3Region, s3Key)
-	video.VideoURL = &videoURL
-	err = cfg.db.UpdateVideo(video)
+	// Every upload is a new version; earlier ones stay around for rollback
+	versionParams := database.CreateVideoVersionParams{
+		VideoID:          video.ID,
+		Source:           database.VersionSourceUpload,
+		VideoURL:         videoURL,
+		SizeBytes:        sizeBytes,
+		OriginalVideoURL: originalVideoURL,
+		PreviewURL:       previewURL,
+		Loudness:         loudness,
+		Audio:            audio,
+		StrippedMetadata: strippedMetadata,
+		Storyboard:       storyboard,
+	}
+	version, err := cfg.db.CreateVideoVersion(versionParams, quota.storeLimits())
+	if err != nil {
+		// Nothing refers to the uploaded files
+		cfg.deleteVersionObjects(r.Context(), database.VideoVersion{CreateVideoVersionParams: versionParams})
+	}
+	if errors.Is(err, database.ErrQuotaExceeded) {
+		cfg.respondQuotaExceeded(w, userID, sizeBytes, false)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Unable to update video ", err)
 		return
 	}
-	log.Printf("Stored VideoURL  : %s (handlerUploadVideo)\n", *video.VideoURL)
+	log.Printf("Stored VideoURL  : %s as version %d (handlerUploadVideo)\n", version.VideoURL, version.Number)
+	cfg.audit(r, database.AuditVideoUpload, &userID, database.AuditTargetVideo, videoID.String(), map[string]string{
+		"version": strconv.Itoa(version.Number),
+		"size":    strconv.FormatInt(sizeBytes, 10),
+	})
+
+	succeeded = true
+	tracker.completed()
 
 }
 
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -44,3 +47,78 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 
 	respondWithJSON(w, http.StatusCreated, user)
 }
+
+// DELETE /api/users deletes the caller's account
+func (cfg *apiConfig) handlerUsersDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.deleteUser(r, userID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /admin/users/{userID}
+func (cfg *apiConfig) handlerAdminUserDelete(w http.ResponseWriter, r *http.Request) {
+	adminID, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.deleteUser(r, adminID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deletes a user with everything they own. The database cascades to
+// their tokens, videos and settings; the files are collected first and
+// removed once the rows are gone. The audit log gets an event for each
+// video and one for the user, all by actorID.
+func (cfg *apiConfig) deleteUser(r *http.Request, actorID, userID uuid.UUID) error {
+	videos, err := cfg.db.GetVideos(userID)
+	if err != nil {
+		return err
+	}
+	trashed, err := cfg.db.GetTrashedVideos(userID)
+	if err != nil {
+		return err
+	}
+	videos = append(videos, trashed...)
+	versions := make([][]database.VideoVersion, len(videos))
+	for i, video := range videos {
+		versions[i], err = cfg.db.GetVideoVersions(video.ID)
+		if err != nil {
+			return err
+		}
+	}
+	watermark, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.db.DeleteUser(userID)
+	if err != nil {
+		return err
+	}
+
+	// Nothing refers to the files once the rows are gone, so finish even
+	// if the client hangs up
+	ctx := context.WithoutCancel(r.Context())
+	for i, video := range videos {
+		cfg.deleteVideoMedia(ctx, video, versions[i])
+		cfg.audit(r, database.AuditVideoDelete, &actorID, database.AuditTargetVideo, video.ID.String(), map[string]string{"title": video.Title})
+	}
+	if watermark != nil {
+		cfg.removeAsset(watermark.ImagePath)
+	}
+	cfg.audit(r, database.AuditUserDelete, &actorID, database.AuditTargetUser, userID.String(), map[string]string{"videos": strconv.Itoa(len(videos))})
+	return nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	clipModeVersion = "version"
+	clipModeNew     = "new"
+)
+
+// clipTimestamp accepts either seconds (12.5, "12.5") or a clock
+// timestamp ("01:02:03.5", "02:03") in JSON and holds seconds.
+type clipTimestamp float64
+
+func (t *clipTimestamp) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*t = clipTimestamp(seconds)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return errors.New("timestamp must be a number of seconds or HH:MM:SS.mmm")
+	}
+	seconds, err := parseClockTimestamp(text)
+	if err != nil {
+		return err
+	}
+	*t = clipTimestamp(seconds)
+	return nil
+}
+
+func parseClockTimestamp(text string) (float64, error) {
+	parts := strings.Split(text, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", text)
+	}
+
+	seconds := 0.0
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", text)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
+
+// POST /api/videos/{videoID}/clip trims the uploaded video to [start, end).
+// With mode "version" (the default) the trimmed copy becomes a new version
+// of the video; with mode "new" it is stored as a new video owned by the
+// same user.
+func (cfg *apiConfig) handlerVideoClip(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Start    *clipTimestamp `json:"start"`
+		End      *clipTimestamp `json:"end"`
+		Reencode bool           `json:"reencode"`
+		Mode     string         `json:"mode"`
+		Title    string         `json:"title"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.Mode == "" {
+		params.Mode = clipModeVersion
+	}
+	if params.Mode != clipModeVersion && params.Mode != clipModeNew {
+		respondWithError(w, http.StatusBadRequest, `Mode must be "version" or "new"`, nil)
+		return
+	}
+	if params.Start == nil || params.End == nil {
+		respondWithError(w, http.StatusBadRequest, "Start and end are required", nil)
+		return
+	}
+	start, end := float64(*params.Start), float64(*params.End)
+	if start < 0 || end <= start {
+		respondWithError(w, http.StatusBadRequest, "End must be after start", nil)
+		return
+	}
+
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusConflict, "Video has no uploaded file to clip", nil)
+		return
+	}
+	_, sourceKey, err := parseStorageLocation(*video.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Invalid stored video location", err)
+		return
+	}
+
+	// A watermarked video is clipped from its clean original and then
+	// watermarked again, so the clip keeps an original of its own
+	sourceURL := *video.VideoURL
+	var watermark *watermarkSettings
+	if video.OriginalVideoURL != nil {
+		sourceURL = *video.OriginalVideoURL
+		watermark, err = cfg.watermarkFor(video.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+			return
+		}
+	}
+
+	if !cfg.acceptMediaWork(w) {
+		return
+	}
+
+	quota, err := cfg.quotaFor(video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	if params.Mode == clipModeNew && !quota.allowsNewVideo() {
+		respondVideoQuotaExceeded(w, quota)
+		return
+	}
+
+	if !cfg.checkScratchSpace(w, 0) {
+		return
+	}
+	jobDir, err := cfg.scratch.Job("clip")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
+		return
+	}
+	defer os.RemoveAll(jobDir)
+
+	tempFile, err := os.Create(filepath.Join(jobDir, "source.mp4"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
+		return
+	}
+	defer tempFile.Close()
+
+	err = cfg.downloadObject(r.Context(), sourceURL, tempFile)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to download video from S3", err)
+		return
+	}
+
+	duration, err := cfg.getVideoDuration(r.Context(), tempFile.Name())
+	if err != nil {
+		respondWithMediaError(w, http.StatusInternalServerError, "Unable to read video duration", err)
+		return
+	}
+	if end > duration {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("End is past the end of the video (%.3fs)", duration), nil)
+		return
+	}
+
+	clipFileName, err := cfg.processVideoClip(r.Context(), tempFile.Name(), start, end, params.Reencode)
+	if err != nil {
+		respondWithMediaError(w, http.StatusInternalServerError, "Unable to clip video", err)
+		return
+	}
+	defer os.Remove(clipFileName)
+
+	clipFile, err := os.Open(clipFileName)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to open clipped video", err)
+		return
+	}
+	defer clipFile.Close()
+
+	uploadFile := clipFile
+	servedFileName := clipFileName
+	if watermark != nil {
+		watermarkedFileName, err := cfg.processVideoWatermark(r.Context(), clipFileName, *watermark)
+		if err != nil {
+			respondWithMediaError(w, http.StatusInternalServerError, "Unable to watermark video", err)
+			return
+		}
+		defer os.Remove(watermarkedFileName)
+
+		watermarkedFile, err := os.Open(watermarkedFileName)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to open watermarked video", err)
+			return
+		}
+		defer watermarkedFile.Close()
+
+		uploadFile = watermarkedFile
+		servedFileName = watermarkedFileName
+	}
+
+	// Both the served clip and its original, if kept, count
+	uploadInfo, err := uploadFile.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read clipped video", err)
+		return
+	}
+	sizeBytes := uploadInfo.Size()
+	if uploadFile != clipFile {
+		clipInfo, err := clipFile.Stat()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to read clipped video", err)
+			return
+		}
+		sizeBytes += clipInfo.Size()
+	}
+	if !quota.allowsBytes(sizeBytes) {
+		respondStorageQuotaExceeded(w, quota, sizeBytes)
+		return
+	}
+
+	// Keep the clip under the same aspect ratio prefix as the source
+	s3Key := path.Join(path.Dir(sourceKey), randomObjectName())
+	var originalVideoURL *string
+	if uploadFile != clipFile {
+		originalLocation, err := cfg.putObject(r.Context(), "originals/"+s3Key, "video/mp4", clipFile)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to copy original to S3", err)
+			return
+		}
+		originalVideoURL = &originalLocation
+	}
+	videoURL, err := cfg.putObject(r.Context(), s3Key, "video/mp4", uploadFile)
+	if err != nil {
+		if originalVideoURL != nil {
+			// Nothing refers to the original yet
+			if err := cfg.deleteObject(context.WithoutCancel(r.Context()), *originalVideoURL); err != nil {
+				log.Printf("Couldn't delete original %s: %v\n", *originalVideoURL, err)
+			}
+		}
+		respondWithError(w, http.StatusInternalServerError, "Unable to copy clip to S3", err)
+		return
+	}
+
+	// A new video gets its ID now, so its files are never filed under the source
+	status := http.StatusOK
+	videoID := video.ID
+	if params.Mode == clipModeNew {
+		videoID = uuid.New()
+		status = http.StatusCreated
+	}
+
+	previewURL := cfg.uploadPreview(r.Context(), videoID, servedFileName, s3Key)
+	storyboard := cfg.uploadStoryboard(r.Context(), videoID, servedFileName, s3Key)
+	// Clips get an audio rendition if the source has one
+	var audio *database.AudioRendition
+	if video.Audio != nil {
+		audio = cfg.uploadAudio(r.Context(), videoID, servedFileName, s3Key)
+	}
+
+	// The clip keeps the source's loudness: trimming doesn't re-measure it
+	version := database.CreateVideoVersionParams{
+		VideoID:          videoID,
+		Source:           database.VersionSourceClip,
+		VideoURL:         videoURL,
+		SizeBytes:        sizeBytes,
+		OriginalVideoURL: originalVideoURL,
+		PreviewURL:       previewURL,
+		Loudness:         video.Loudness,
+		Audio:            audio,
+		// Clips are cut from the stored file, so whatever was stripped
+		// from the source is missing from them too
+		StrippedMetadata: video.StrippedMetadata,
+		Storyboard:       storyboard,
+	}
+	title := params.Title
+	if title == "" {
+		title = fmt.Sprintf("%s (clip)", video.Title)
+	}
+	// A new video starts at version 1
+	number := 1
+	if params.Mode == clipModeNew {
+		_, err = cfg.db.CreateVideoWithVersion(videoID, database.CreateVideoParams{
+			Title:       title,
+			Description: video.Description,
+			UserID:      video.UserID,
+		}, version, quota.storeLimits())
+	} else {
+		var stored database.VideoVersion
+		stored, err = cfg.db.CreateVideoVersion(version, quota.storeLimits())
+		number = stored.Number
+	}
+	if err != nil {
+		// Nothing refers to the uploaded files
+		cfg.deleteVersionObjects(r.Context(), database.VideoVersion{CreateVideoVersionParams: version})
+	}
+	if errors.Is(err, database.ErrQuotaExceeded) {
+		cfg.respondQuotaExceeded(w, video.UserID, sizeBytes, params.Mode == clipModeNew)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
+		return
+	}
+	if params.Mode == clipModeNew {
+		cfg.audit(r, database.AuditVideoCreate, &video.UserID, database.AuditTargetVideo, videoID.String(), map[string]string{
+			"title":   title,
+			"clip_of": video.ID.String(),
+		})
+	}
+	cfg.audit(r, database.AuditVideoUpload, &video.UserID, database.AuditTargetVideo, videoID.String(), map[string]string{
+		"version": strconv.Itoa(number),
+		"size":    strconv.FormatInt(sizeBytes, 10),
+		"clip_of": video.ID.String(),
+	})
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	video, err = cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get presigned video url", err)
+		return
+	}
+
+	respondWithJSON(w, status, video)
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -35,12 +42,27 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 	}
 	params.UserID = userID
 
+	quota, err := cfg.quotaFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	if !quota.allowsNewVideo() {
+		respondVideoQuotaExceeded(w, quota)
+		return
+	}
+
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	if errors.Is(err, database.ErrInvalidTags) || errors.Is(err, database.ErrUnknownCategory) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
 
+	cfg.audit(r, database.AuditVideoCreate, &userID, database.AuditTargetVideo, video.ID.String(), map[string]string{"title": video.Title})
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
@@ -73,15 +95,37 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	if video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Video is already in the trash", nil)
+		return
+	}
+
+	// The purge deletes it for good once the trash retention has passed
+	err = cfg.db.TrashVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
 
+	cfg.audit(r, database.AuditVideoDelete, &userID, database.AuditTargetVideo, videoID.String(), map[string]string{"title": video.Title})
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Removes the thumbnails, captions and every version's files of a video
+// whose rows are already gone, so failures are only logged.
+func (cfg *apiConfig) deleteVideoMedia(ctx context.Context, video database.Video, versions []database.VideoVersion) {
+	cfg.removeAssets(video.Thumbnails)
+	for _, caption := range video.Captions {
+		err := cfg.deleteObject(ctx, caption.CaptionURL)
+		if err != nil {
+			log.Printf("Couldn't delete caption %s of video %s: %v\n", caption.Language, video.ID, err)
+		}
+	}
+	for _, version := range versions {
+		cfg.deleteVersionObjects(ctx, version)
+	}
+}
+
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -95,20 +139,148 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
 
-	if video.VideoURL != nil {
-		log.Printf("handlerVideoGet  : video.VideoURL is not nil: %v\n", *video.VideoURL)
-		video, err = cfg.dbVideoToSignedVideo(video)
-		if err != nil {
-			respondWithError(w, http.StatusBadRequest, "Unable to get presigned video url ", err)
+	video, err = cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to get presigned video url ", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+)
+
+// PATCH /api/videos/{videoID} changes the fields in the body: title,
+// description, tags and category (null for none). The response carries
+// the new ETag. With an If-Match header the update only goes through if
+// the video still has that ETag, so edits from two tabs don't silently
+// overwrite each other; otherwise it's 412 Precondition Failed.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var ifVersion *int
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && strings.TrimSpace(ifMatch) != "*" {
+		if !etagMatches(ifMatch, videoETag(video)) {
+			respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was loaded", nil)
 			return
 		}
-		log.Printf("handlerVideoGet  : video.VideoURL is nil")
+		// Checked again as part of the update in case of a concurrent edit
+		ifVersion = &video.Version
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	details, err := decodeVideoDetails(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	err = cfg.db.UpdateVideoDetails(video.ID, details, ifVersion)
+	if errors.Is(err, database.ErrVideoModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was loaded", err)
+		return
+	}
+	if errors.Is(err, database.ErrInvalidTags) || errors.Is(err, database.ErrUnknownCategory) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, video.ID)
+}
+
+// Only the fields present in the body are changed, so it's decoded field
+// by field to tell a missing category from a null one.
+func decodeVideoDetails(r *http.Request) (database.VideoDetails, error) {
+	var fields map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&fields)
+	if err != nil {
+		return database.VideoDetails{}, errors.New("couldn't decode parameters")
+	}
+
+	var details database.VideoDetails
+	for name, value := range fields {
+		switch name {
+		case "title":
+			err = json.Unmarshal(value, &details.Title)
+			if err == nil && (details.Title == nil || strings.TrimSpace(*details.Title) == "") {
+				return details, errors.New("title can't be empty")
+			}
+			if err == nil && len(*details.Title) > maxVideoTitleLength {
+				return details, fmt.Errorf("title can be at most %d bytes", maxVideoTitleLength)
+			}
+		case "description":
+			description := ""
+			err = json.Unmarshal(value, &description)
+			details.Description = &description
+			if err == nil && len(description) > maxVideoDescriptionLength {
+				return details, fmt.Errorf("description can be at most %d bytes", maxVideoDescriptionLength)
+			}
+		case "tags":
+			var tags []string
+			err = json.Unmarshal(value, &tags)
+			details.Tags = &tags
+		case "category":
+			err = json.Unmarshal(value, &details.Category)
+			details.SetCategory = true
+		default:
+			return details, fmt.Errorf("%s can't be changed", name)
+		}
+		if err != nil {
+			return details, fmt.Errorf("%s has the wrong type", name)
+		}
+	}
+	return details, nil
+}
+
+// videoETag changes whenever the video is updated. It is the video's
+// write counter, so even two updates within the same second differ.
+func videoETag(video database.Video) string {
+	return `"` + strconv.Itoa(video.Version) + `"`
 }
 
+// etagMatches does the strong comparison If-Match calls for against every
+// ETag in the header. Weak ETags never match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Largest page GET /api/videos returns
+const maxVideoPageSize = 100
+
+// GET /api/videos lists the caller's videos a page at a time. Query
+// parameters:
+//
+//	limit           page size, 50 by default, at most 100
+//	cursor          next_cursor of the previous page
+//	sort            created_at, updated_at or title, "-" first to reverse;
+//	                -created_at by default
+//	has_video       true or false
+//	has_thumbnail   true or false
+//	aspect_ratio    landscape, portrait or other
+//	created_after   RFC 3339 time or YYYY-MM-DD, inclusive
+//	created_before  RFC 3339 time or YYYY-MM-DD, exclusive
+//	tag             only videos with this tag
+//	category        only videos in this category
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -121,26 +293,110 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	opts, err := parseVideoListOptions(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	page, err := cfg.db.GetVideoPage(userID, opts)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	newVideos := []database.Video{}
+	for i := range page.Videos {
+		page.Videos[i], err = cfg.dbVideoToSignedVideo(page.Videos[i])
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Unable to get presigned video url ", err)
+			return
+		}
+	}
 
-	for _ , video:= range(videos) {
-		if video.VideoURL != nil {
-			log.Printf("handlerVideosRetrieve (before): video.VideoURL = %v\n", video.VideoURL)
-			video, err = cfg.dbVideoToSignedVideo(video)
-			if err != nil {
-				respondWithError(w, http.StatusBadRequest, "Unable to get presigned video url ", err)
-				return
-			}
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+func parseVideoListOptions(query url.Values) (database.VideoListOptions, error) {
+	opts := database.VideoListOptions{
+		Limit:       database.DefaultVideoPageSize,
+		Cursor:      query.Get("cursor"),
+		Sort:        query.Get("sort"),
+		AspectRatio: query.Get("aspect_ratio"),
+		Category:    query.Get("category"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxVideoPageSize {
+			return opts, fmt.Errorf("limit must be between 1 and %d", maxVideoPageSize)
+		}
+		opts.Limit = limit
+	}
+	if opts.Sort != "" && !database.ValidVideoSort(opts.Sort) {
+		return opts, fmt.Errorf("sort must be one of %s", strings.Join(database.VideoSorts, ", "))
+	}
+	if opts.AspectRatio != "" && !database.ValidAspectRatio(opts.AspectRatio) {
+		return opts, errors.New("aspect_ratio must be landscape, portrait or other")
+	}
+
+	if value := query.Get("tag"); value != "" {
+		tags, err := database.NormalizeTags([]string{value})
+		if err != nil {
+			return opts, err
 		}
-		newVideos = append(newVideos, video)
+		if len(tags) > 0 {
+			opts.Tag = tags[0]
+		}
+	}
+
+	var err error
+	opts.HasVideo, err = parseBoolParam(query, "has_video")
+	if err != nil {
+		return opts, err
+	}
+	opts.HasThumbnail, err = parseBoolParam(query, "has_thumbnail")
+	if err != nil {
+		return opts, err
 	}
+	opts.CreatedAfter, err = parseTimeParam(query, "created_after")
+	if err != nil {
+		return opts, err
+	}
+	opts.CreatedBefore, err = parseTimeParam(query, "created_before")
+	if err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
 
-	respondWithJSON(w, http.StatusOK, newVideos)
-	// respondWithJSON(w, http.StatusOK, videos)
+// nil when the parameter isn't set
+func parseBoolParam(query url.Values, name string) (*bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &parsed, nil
+}
+
+// nil when the parameter isn't set. Dates are midnight UTC.
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			return &parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
 }
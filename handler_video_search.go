@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// GET /api/videos/search?q= searches the titles and descriptions of the
+// caller's videos, best match first. Takes limit and cursor like GET
+// /api/videos.
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	terms := database.SearchTerms(query.Get("q"))
+	if len(terms) == 0 {
+		respondWithError(w, http.StatusBadRequest, "q must contain at least one word", nil)
+		return
+	}
+
+	limit := database.DefaultVideoPageSize
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxVideoPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxVideoPageSize), err)
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := cfg.db.SearchVideos(userID, terms, limit, query.Get("cursor"))
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	for i := range page.Results {
+		page.Results[i].Video, err = cfg.dbVideoToSignedVideo(page.Results[i].Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to get presigned video url", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
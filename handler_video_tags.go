@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// GET /api/categories lists the categories a video can be filed under.
+func (cfg *apiConfig) handlerCategoriesList(w http.ResponseWriter, r *http.Request) {
+	categories, err := cfg.db.GetCategories()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve categories", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, categories)
+}
+
+// GET /api/tags lists the tags on the caller's videos, most used first.
+func (cfg *apiConfig) handlerTagsList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	tags, err := cfg.db.GetUserTags(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve tags", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+// PUT /api/videos/{videoID}/tags replaces the video's tags.
+func (cfg *apiConfig) handlerVideoTagsUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Tags []string `json:"tags"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.SetVideoTags(video.ID, params.Tags)
+	if errors.Is(err, database.ErrInvalidTags) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save tags", err)
+		return
+	}
+	cfg.respondWithVideo(w, video.ID)
+}
+
+// PUT /api/videos/{videoID}/category files the video under a category,
+// or under none for a null category.
+func (cfg *apiConfig) handlerVideoCategoryUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Category *string `json:"category"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.SetVideoCategory(video.ID, params.Category)
+	if errors.Is(err, database.ErrUnknownCategory) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save category", err)
+		return
+	}
+	cfg.respondWithVideo(w, video.ID)
+}
+
+// Responds with the video as it is stored now, presigned and with its ETag
+func (cfg *apiConfig) respondWithVideo(w http.ResponseWriter, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	video, err = cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get presigned video url", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
+}
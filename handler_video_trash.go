@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type trashedVideo struct {
+	database.Video
+	// PurgeAt is when the video is deleted for good unless restored
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// GET /api/videos/trash lists the caller's deleted videos, most recently
+// deleted first.
+func (cfg *apiConfig) handlerVideosTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	videos, err := cfg.db.GetTrashedVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trash", err)
+		return
+	}
+
+	trash := make([]trashedVideo, len(videos))
+	for i, video := range videos {
+		video, err = cfg.dbVideoToSignedVideo(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to get presigned video url", err)
+			return
+		}
+		trash[i] = trashedVideo{Video: video, PurgeAt: video.DeletedAt.Add(cfg.trashRetention)}
+	}
+
+	respondWithJSON(w, http.StatusOK, trash)
+}
+
+// POST /api/videos/{videoID}/restore takes a video back out of the trash.
+func (cfg *apiConfig) handlerVideoRestore(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "User is not the video owner", nil)
+		return
+	}
+	if video.DeletedAt == nil {
+		respondWithError(w, http.StatusConflict, "Video is not in the trash", nil)
+		return
+	}
+
+	err = cfg.db.RestoreVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	cfg.audit(r, database.AuditVideoRestore, &userID, database.AuditTargetVideo, videoID.String(), nil)
+
+	cfg.respondWithVideo(w, videoID)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// GET /api/videos/{videoID}/versions lists every stored version of the
+// video, newest first, with presigned URLs to watch each of them.
+func (cfg *apiConfig) handlerVideoVersionsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get versions", err)
+		return
+	}
+
+	for i := range versions {
+		versions[i], err = cfg.signVersion(versions[i])
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to get presigned video url", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, versions)
+}
+
+// POST /api/videos/{videoID}/versions/{version}/rollback makes an earlier
+// version the current one again. Later versions are kept.
+func (cfg *apiConfig) handlerVideoVersionRollback(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid version", err)
+		return
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := cfg.db.GetVideoVersion(video.ID, number)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get version", err)
+		return
+	}
+	if version.Number == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't get version", nil)
+		return
+	}
+
+	if !version.Current {
+		err = cfg.db.SetCurrentVersion(version)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
+			return
+		}
+	}
+
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	video, err = cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get presigned video url", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// DELETE /api/videos/{videoID}/versions?keep=N deletes every version but
+// the current one and the N newest others (0 by default), stored files
+// included.
+func (cfg *apiConfig) handlerVideoVersionsPurge(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Deleted []int `json:"deleted"`
+	}
+
+	keep := 0
+	if value := r.URL.Query().Get("keep"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			respondWithError(w, http.StatusBadRequest, "keep must be a non-negative number", err)
+			return
+		}
+		keep = parsed
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get versions", err)
+		return
+	}
+
+	// A deleted row can't be found again, so its files have to go even if
+	// the client hangs up
+	ctx := context.WithoutCancel(r.Context())
+	deleted := []int{}
+	for _, version := range versions {
+		if version.Current {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+
+		err = cfg.db.DeleteVideoVersion(version.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't delete version", err)
+			return
+		}
+		cfg.deleteVersionObjects(ctx, version)
+		deleted = append(deleted, version.Number)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{Deleted: deleted})
+}
+
+func (cfg *apiConfig) signVersion(version database.VideoVersion) (database.VideoVersion, error) {
+	videoURL, err := cfg.presignStorageLocation(version.VideoURL)
+	if err != nil {
+		return version, err
+	}
+	version.VideoURL = videoURL
+
+	if version.PreviewURL != nil {
+		previewURL, err := cfg.presignStorageLocation(*version.PreviewURL)
+		if err != nil {
+			return version, err
+		}
+		version.PreviewURL = &previewURL
+	}
+
+	if version.Audio != nil {
+		audio, err := cfg.signAudio(*version.Audio)
+		if err != nil {
+			return version, err
+		}
+		version.Audio = &audio
+	}
+
+	return version, nil
+}
+
+// Removes every object stored for a version. The rows are already gone,
+// so failures are only logged.
+func (cfg *apiConfig) deleteVersionObjects(ctx context.Context, version database.VideoVersion) {
+	locations := []string{version.VideoURL}
+	if version.OriginalVideoURL != nil {
+		locations = append(locations, *version.OriginalVideoURL)
+	}
+	if version.PreviewURL != nil {
+		locations = append(locations, *version.PreviewURL)
+	}
+	if version.Audio != nil {
+		locations = append(locations, version.Audio.AudioURL)
+	}
+	if version.Storyboard != nil {
+		locations = append(locations, storyboardObjects(*version.Storyboard)...)
+	}
+
+	for _, location := range locations {
+		err := cfg.deleteObject(ctx, location)
+		if err != nil {
+			log.Printf("Couldn't delete %s of video %s version %d: %v\n", location, version.VideoID, version.Number, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Largest watermark image, plenty for a logo
+const maxWatermarkSize = 10 << 20
+
+type watermarkResponse struct {
+	database.Watermark
+	ImageURL string `json:"image_url"`
+}
+
+func (cfg *apiConfig) handlerWatermarkGet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	watermark, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+	if watermark == nil {
+		respondWithError(w, http.StatusNotFound, "No watermark set", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, watermarkResponse{
+		Watermark: *watermark,
+		ImageURL:  cfg.assetURL(watermark.ImagePath),
+	})
+}
+
+// PUT /api/watermark sets the user's watermark. The "watermark" image is
+// required the first time and optional afterwards, so position, opacity
+// and scale can be changed on their own. Settings that aren't sent keep
+// their current value, or the deployment default.
+func (cfg *apiConfig) handlerWatermarkUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWatermarkSize+uploadFormOverhead)
+	const maxMemory = 10 << 20
+	err := r.ParseMultipartForm(maxMemory)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Watermark image is larger than 10 MB", err)
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
+		return
+	}
+
+	existing, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+
+	settings := watermarkSettings{
+		position: cfg.watermark.position,
+		opacity:  cfg.watermark.opacity,
+		scale:    cfg.watermark.scale,
+	}
+	if existing != nil {
+		settings.imagePath = existing.ImagePath
+		settings.position = existing.Position
+		settings.opacity = existing.Opacity
+		settings.scale = existing.Scale
+	}
+
+	if value := r.FormValue("position"); value != "" {
+		settings.position = value
+	}
+	if value := r.FormValue("opacity"); value != "" {
+		settings.opacity, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid opacity", err)
+			return
+		}
+	}
+	if value := r.FormValue("scale"); value != "" {
+		settings.scale, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid scale", err)
+			return
+		}
+	}
+	if err := settings.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	file, _, err := r.FormFile("watermark")
+	switch {
+	case err == http.ErrMissingFile && existing != nil:
+		// Only the settings change
+	case err != nil:
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	default:
+		defer file.Close()
+		filename, err := cfg.storeWatermarkImage(r.Context(), file)
+		if err != nil {
+			respondWithMediaError(w, http.StatusBadRequest, "Unable to process watermark image", err)
+			return
+		}
+		settings.imagePath = filename
+	}
+
+	watermark, err := cfg.db.UpsertWatermark(database.Watermark{
+		UserID:    userID,
+		ImagePath: settings.imagePath,
+		Position:  settings.position,
+		Opacity:   settings.opacity,
+		Scale:     settings.scale,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save watermark", err)
+		return
+	}
+	if existing != nil && existing.ImagePath != watermark.ImagePath {
+		cfg.removeAsset(existing.ImagePath)
+	}
+
+	respondWithJSON(w, http.StatusOK, watermarkResponse{
+		Watermark: *watermark,
+		ImageURL:  cfg.assetURL(watermark.ImagePath),
+	})
+}
+
+func (cfg *apiConfig) handlerWatermarkDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	watermark, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+	if watermark == nil {
+		respondWithError(w, http.StatusNotFound, "No watermark set", nil)
+		return
+	}
+
+	err = cfg.db.DeleteWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete watermark", err)
+		return
+	}
+	cfg.removeAsset(watermark.ImagePath)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Saves an uploaded watermark image into the assets directory under a
+// random name and returns that name.
+func (cfg *apiConfig) storeWatermarkImage(ctx context.Context, file io.Reader) (string, error) {
+	jobDir, err := cfg.scratch.Job("watermark")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(jobDir)
+
+	tempFile, err := os.Create(filepath.Join(jobDir, "watermark"))
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	_, err = io.Copy(tempFile, file)
+	if err != nil {
+		return "", err
+	}
+
+	filename := fmt.Sprintf("watermark-%s.png", randomObjectName())
+	err = cfg.processWatermarkImage(ctx, tempFile.Name(), filepath.Join(cfg.assetsRoot, filename))
+	if err != nil {
+		os.Remove(filepath.Join(cfg.assetsRoot, filename))
+		return "", err
+	}
+	return filename, nil
+}
+
+// Returns the watermark to burn into a user's uploads: their own if they
+// have one, otherwise the deployment's, otherwise nil.
+func (cfg *apiConfig) watermarkFor(userID uuid.UUID) (*watermarkSettings, error) {
+	watermark, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		return nil, err
+	}
+	if watermark != nil {
+		return &watermarkSettings{
+			imagePath: filepath.Join(cfg.assetsRoot, watermark.ImagePath),
+			position:  watermark.Position,
+			opacity:   watermark.Opacity,
+			scale:     watermark.Scale,
+		}, nil
+	}
+
+	if cfg.watermark.imagePath == "" {
+		return nil, nil
+	}
+	settings := cfg.watermark
+	return &settings, nil
+}
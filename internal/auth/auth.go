@@ -18,6 +18,9 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "tubely-access"
+	// TokenTypeProgress only lets its holder watch the upload progress of
+	// one video
+	TokenTypeProgress TokenType = "tubely-progress"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
@@ -50,11 +53,43 @@ func MakeJWT(
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return validateToken(tokenString, tokenSecret, TokenTypeAccess)
+}
+
+// MakeProgressToken issues a token for the upload progress of videoID
+// only. Unlike the access JWT it may go in a URL, EventSource can't set
+// headers: whoever finds it in a log can't do anything else with it, and
+// not for long.
+func MakeProgressToken(
+	userID uuid.UUID,
+	videoID uuid.UUID,
+	tokenSecret string,
+	expiresIn time.Duration,
+) (string, error) {
+	signingKey := []byte(tokenSecret)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeProgress),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{videoID.String()},
+	})
+	return token.SignedString(signingKey)
+}
+
+// ValidateProgressToken returns the user a MakeProgressToken token was
+// issued to, if it was issued for videoID.
+func ValidateProgressToken(tokenString, tokenSecret string, videoID uuid.UUID) (uuid.UUID, error) {
+	return validateToken(tokenString, tokenSecret, TokenTypeProgress, jwt.WithAudience(videoID.String()))
+}
+
+func validateToken(tokenString, tokenSecret string, tokenType TokenType, options ...jwt.ParserOption) (uuid.UUID, error) {
 	claimsStruct := jwt.RegisteredClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
 		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		options...,
 	)
 	if err != nil {
 		return uuid.Nil, err
@@ -69,7 +104,7 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	if err != nil {
 		return uuid.Nil, err
 	}
-	if issuer != string(TokenTypeAccess) {
+	if issuer != string(tokenType) {
 		return uuid.Nil, errors.New("invalid issuer")
 	}
 
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions
+const (
+	AuditLogin          = "login"
+	AuditLoginFailed    = "login_failed"
+	AuditTokenRefresh   = "token_refresh"
+	AuditTokenRevoke    = "token_revoke"
+	AuditUserDelete     = "user_delete"
+	AuditVideoCreate    = "video_create"
+	AuditVideoUpload    = "video_upload"
+	AuditVideoThumbnail = "video_thumbnail"
+	AuditVideoDelete    = "video_delete"
+	AuditVideoRestore   = "video_restore"
+	AuditVideoPurge     = "video_purge"
+)
+
+// Audit target types
+const (
+	AuditTargetUser  = "user"
+	AuditTargetVideo = "video"
+)
+
+// DefaultAuditPageSize is the page size when AuditEventFilter.Limit is 0
+const DefaultAuditPageSize = 100
+
+// AuditEvent is one entry of the append-only audit log. ActorID is nil
+// for actions nobody was signed in for, like a failed login or the trash
+// purge.
+type AuditEvent struct {
+	ID         int64             `json:"id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Action     string            `json:"action"`
+	ActorID    *uuid.UUID        `json:"actor_id"`
+	TargetType string            `json:"target_type"`
+	TargetID   string            `json:"target_id"`
+	IP         string            `json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	Details    map[string]string `json:"details"`
+}
+
+// AuditEventFilter narrows down the audit log. Zero values don't filter.
+type AuditEventFilter struct {
+	Action     string
+	ActorID    *uuid.UUID
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	// BeforeID pages back, newest first, from the last event seen
+	BeforeID int64
+	// Limit is DefaultAuditPageSize if 0, and unlimited if negative
+	Limit int
+	// Oldest lists the oldest events first instead of the newest
+	Oldest bool
+}
+
+func (c Client) CreateAuditEvent(event AuditEvent) error {
+	var details sql.NullString
+	if len(event.Details) > 0 {
+		data, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(data), Valid: true}
+	}
+
+	query := `
+	INSERT INTO audit_events (
+		created_at,
+		action,
+		actor_id,
+		target_type,
+		target_id,
+		ip,
+		user_agent,
+		details
+	) VALUES (CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(
+		query,
+		event.Action,
+		event.ActorID,
+		event.TargetType,
+		event.TargetID,
+		event.IP,
+		event.UserAgent,
+		details,
+	)
+	return err
+}
+
+// GetAuditEvents returns a page of the events matching the filter.
+func (c Client) GetAuditEvents(filter AuditEventFilter) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	err := c.EachAuditEvent(filter, func(event AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// EachAuditEvent calls fn with every event matching the filter without
+// holding them all in memory, stopping at the first error fn returns.
+func (c Client) EachAuditEvent(filter AuditEventFilter, fn func(AuditEvent) error) error {
+	where := []string{"1 = 1"}
+	args := []any{}
+	if filter.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.ActorID != nil {
+		where = append(where, "actor_id = ?")
+		args = append(args, *filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.Since != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, c.db.dialect.timeValue(*filter.Since))
+	}
+	if filter.Until != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, c.db.dialect.timeValue(*filter.Until))
+	}
+	if filter.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	direction := "DESC"
+	if filter.Oldest {
+		direction = "ASC"
+	}
+	query := `
+	SELECT id, created_at, action, actor_id, target_type, target_id, ip, user_agent, details
+	FROM audit_events
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY id ` + direction
+	if filter.Limit == 0 {
+		filter.Limit = DefaultAuditPageSize
+	}
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event AuditEvent
+		var details sql.NullString
+		err := rows.Scan(
+			&event.ID,
+			&event.CreatedAt,
+			&event.Action,
+			&event.ActorID,
+			&event.TargetType,
+			&event.TargetID,
+			&event.IP,
+			&event.UserAgent,
+			&details,
+		)
+		if err != nil {
+			return err
+		}
+		if details.Valid {
+			err = json.Unmarshal([]byte(details.String), &event.Details)
+			if err != nil {
+				return err
+			}
+		}
+		err = fn(event)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
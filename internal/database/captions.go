@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Caption is a WebVTT caption track for one language of a video.
+// CaptionURL is stored as "bucket,key", like Video.VideoURL, and is
+// swapped for a presigned URL before it is sent to clients.
+type Caption struct {
+	VideoID    uuid.UUID `json:"video_id"`
+	Language   string    `json:"language"`
+	Label      string    `json:"label"`
+	CaptionURL string    `json:"url"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (c Client) GetCaptions(videoID uuid.UUID) ([]Caption, error) {
+	query := `
+	SELECT video_id, language, label, caption_url, created_at, updated_at
+	FROM video_captions
+	WHERE video_id = ?
+	ORDER BY language
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	captions := []Caption{}
+	for rows.Next() {
+		var caption Caption
+		if err := rows.Scan(
+			&caption.VideoID,
+			&caption.Language,
+			&caption.Label,
+			&caption.CaptionURL,
+			&caption.CreatedAt,
+			&caption.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		captions = append(captions, caption)
+	}
+
+	return captions, rows.Err()
+}
+
+// GetCaption returns nil if the video has no track for that language.
+func (c Client) GetCaption(videoID uuid.UUID, language string) (*Caption, error) {
+	query := `
+	SELECT video_id, language, label, caption_url, created_at, updated_at
+	FROM video_captions
+	WHERE video_id = ? AND language = ?
+	`
+
+	var caption Caption
+	err := c.db.QueryRow(query, videoID, language).Scan(
+		&caption.VideoID,
+		&caption.Language,
+		&caption.Label,
+		&caption.CaptionURL,
+		&caption.CreatedAt,
+		&caption.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &caption, nil
+}
+
+// UpsertCaption creates the track for caption.Language or replaces it.
+func (c Client) UpsertCaption(caption Caption) (*Caption, error) {
+	query := `
+	INSERT INTO video_captions (
+		video_id,
+		language,
+		label,
+		caption_url,
+		created_at,
+		updated_at
+	) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	ON CONFLICT(video_id, language) DO UPDATE SET
+		label = excluded.label,
+		caption_url = excluded.caption_url,
+		updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := c.db.Exec(query, caption.VideoID, caption.Language, caption.Label, caption.CaptionURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetCaption(caption.VideoID, caption.Language)
+}
+
+func (c Client) DeleteCaption(videoID uuid.UUID, language string) error {
+	query := `
+	DELETE FROM video_captions
+	WHERE video_id = ? AND language = ?
+	`
+	_, err := c.db.Exec(query, videoID, language)
+	return err
+}
@@ -3,87 +3,134 @@ package database
 import (
 	"database/sql"
 	"fmt"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// Client is the app's database, on SQLite or Postgres. See Repository.
 type Client struct {
-	db *sql.DB
+	db     *conn
+	search searchIndex
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// NewClient opens the database and brings its schema up to date. dsn is
+// a postgres:// URL or the path to a SQLite file.
+func NewClient(dsn string) (Client, error) {
+	c, err := Open(dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	err = c.Migrate()
+	if err != nil {
+		return Client{}, err
+	}
+	err = c.backfillVideoVersions()
+	if err != nil {
+		return Client{}, err
+	}
+	c.search, err = c.prepareSearch()
 	if err != nil {
 		return Client{}, err
 	}
 	return c, nil
+}
+
+// Open opens the database as it is, without migrating it.
+func Open(dsn string) (Client, error) {
+	dialect, dataSource := dialectFor(dsn)
+	db, err := sql.Open(dialect.driver(), dataSource)
+	if err != nil {
+		return Client{}, err
+	}
+	return Client{db: &conn{DB: db, dialect: dialect}}, nil
+}
 
+// Ping checks the database can be reached.
+func (c Client) Ping() error {
+	return c.db.Ping()
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
+func (c Client) Close() error {
+	return c.db.Close()
+}
+
+// addColumnIfMissing extends tables created by older versions of the app,
+// which CREATE TABLE IF NOT EXISTS leaves untouched.
+func (c Client) addColumnIfMissing(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
 		return err
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
-	if err != nil {
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
 		return err
 	}
+	rows.Close()
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
 	}
 	return nil
 }
 
+// Reset empties every table, children before the rows they reference.
+// The audit log is append-only and kept.
 func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	if _, err := c.db.Exec("DELETE FROM user_watermarks"); err != nil {
+		return fmt.Errorf("failed to reset table user_watermarks: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM user_quotas"); err != nil {
+		return fmt.Errorf("failed to reset table user_quotas: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_captions"); err != nil {
+		return fmt.Errorf("failed to reset table video_captions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_storyboards"); err != nil {
+		return fmt.Errorf("failed to reset table video_storyboards: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_thumbnails"); err != nil {
+		return fmt.Errorf("failed to reset table video_thumbnails: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_version_storyboards"); err != nil {
+		return fmt.Errorf("failed to reset table video_version_storyboards: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_versions"); err != nil {
+		return fmt.Errorf("failed to reset table video_versions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM playlist_items"); err != nil {
+		return fmt.Errorf("failed to reset table playlist_items: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM playlists"); err != nil {
+		return fmt.Errorf("failed to reset table playlists: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_tags"); err != nil {
+		return fmt.Errorf("failed to reset table video_tags: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM tags"); err != nil {
+		return fmt.Errorf("failed to reset table tags: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_categories"); err != nil {
+		return fmt.Errorf("failed to reset table video_categories: %w", err)
 	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
+		return fmt.Errorf("failed to reset table users: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,19 @@
+package database_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database/databasetest"
+)
+
+func TestSQLite(t *testing.T) {
+	databasetest.Run(t, databasetest.SQLite)
+}
+
+func TestPostgres(t *testing.T) {
+	if os.Getenv("TUBELY_TEST_POSTGRES_URL") == "" {
+		t.Skip("TUBELY_TEST_POSTGRES_URL is not set")
+	}
+	databasetest.Run(t, databasetest.Postgres)
+}
@@ -0,0 +1,1011 @@
+// Package databasetest is a conformance suite for database.Repository.
+// Every backend runs the same checks, so handlers can rely on the
+// behaviour whichever DB_URL a deployment uses:
+//
+//	func TestSQLite(t *testing.T)   { databasetest.Run(t, databasetest.SQLite) }
+//	func TestPostgres(t *testing.T) { databasetest.Run(t, databasetest.Postgres) }
+//
+// Postgres runs against TUBELY_TEST_POSTGRES_URL, a database the suite is
+// free to wipe, and is skipped when that isn't set or can't be reached.
+package databasetest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Opener returns an empty, migrated repository that is closed when the
+// test ends.
+type Opener func(t *testing.T) database.Repository
+
+// SQLite opens a fresh database file in the test's temp dir.
+func SQLite(t *testing.T) database.Repository {
+	t.Helper()
+	db, err := open(t, filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("couldn't open SQLite database: %v", err)
+	}
+	return db
+}
+
+// Postgres opens the database named by TUBELY_TEST_POSTGRES_URL and
+// empties it. Only an unreachable server skips the test; a migration
+// that fails on it is an error.
+func Postgres(t *testing.T) database.Repository {
+	t.Helper()
+	url := os.Getenv("TUBELY_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TUBELY_TEST_POSTGRES_URL is not set")
+	}
+	probe, err := database.Open(url)
+	if err == nil {
+		err = probe.Ping()
+		probe.Close()
+	}
+	if err != nil {
+		t.Skipf("couldn't reach Postgres at TUBELY_TEST_POSTGRES_URL: %v", err)
+	}
+
+	db, err := open(t, url)
+	if err != nil {
+		t.Fatalf("couldn't set up Postgres database: %v", err)
+	}
+	return db
+}
+
+func open(t *testing.T, dsn string) (database.Repository, error) {
+	db, err := database.NewClient(dsn)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Reset()
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Run checks the repository open returns against the behaviour the
+// handlers rely on. Each subtest gets a repository of its own.
+func Run(t *testing.T, open Opener) {
+	t.Run("users", func(t *testing.T) { testUsers(t, open(t)) })
+	t.Run("refresh tokens", func(t *testing.T) { testRefreshTokens(t, open(t)) })
+	t.Run("videos", func(t *testing.T) { testVideos(t, open(t)) })
+	t.Run("video pages", func(t *testing.T) { testVideoPages(t, open(t)) })
+	t.Run("video versions", func(t *testing.T) { testVideoVersions(t, open(t)) })
+	t.Run("search", func(t *testing.T) { testSearch(t, open(t)) })
+	t.Run("user quotas", func(t *testing.T) { testUserQuotas(t, open(t)) })
+	t.Run("watermarks", func(t *testing.T) { testWatermarks(t, open(t)) })
+	t.Run("trash", func(t *testing.T) { testTrash(t, open(t)) })
+	t.Run("tags", func(t *testing.T) { testTags(t, open(t)) })
+	t.Run("playlists", func(t *testing.T) { testPlaylists(t, open(t)) })
+	t.Run("video details", func(t *testing.T) { testVideoDetails(t, open(t)) })
+	t.Run("audit events", func(t *testing.T) { testAuditEvents(t, open(t)) })
+	t.Run("foreign keys", func(t *testing.T) { testForeignKeys(t, open(t)) })
+}
+
+func createUser(t *testing.T, db database.Repository, email string) *database.User {
+	t.Helper()
+	user, err := db.CreateUser(database.CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+func testUsers(t *testing.T, db database.Repository) {
+	user := createUser(t, db, "alice@example.com")
+	if user.ID == uuid.Nil || user.Email != "alice@example.com" || user.Password != "hash" {
+		t.Fatalf("CreateUser returned %+v", user)
+	}
+	if user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Errorf("CreateUser didn't set timestamps: %+v", user)
+	}
+
+	if _, err := db.CreateUser(database.CreateUserParams{Email: "alice@example.com", Password: "x"}); err == nil {
+		t.Errorf("CreateUser accepted a duplicate email")
+	}
+
+	got, err := db.GetUser(user.ID)
+	if err != nil || got == nil || got.Email != user.Email {
+		t.Errorf("GetUser = %+v, %v", got, err)
+	}
+	byEmail, err := db.GetUserByEmail("alice@example.com")
+	if err != nil || byEmail.ID != user.ID {
+		t.Errorf("GetUserByEmail = %+v, %v", byEmail, err)
+	}
+
+	missing, err := db.GetUser(uuid.New())
+	if err != nil || missing != nil {
+		t.Errorf("GetUser of an unknown ID = %+v, %v, want nil, nil", missing, err)
+	}
+	noEmail, err := db.GetUserByEmail("nobody@example.com")
+	if err != nil || noEmail.ID != uuid.Nil {
+		t.Errorf("GetUserByEmail of an unknown email = %+v, %v, want a zero user", noEmail, err)
+	}
+
+	createUser(t, db, "bob@example.com")
+	users, err := db.GetUsers()
+	if err != nil || len(users) != 2 {
+		t.Errorf("GetUsers = %d users, %v, want 2", len(users), err)
+	}
+
+	if err := db.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	deleted, err := db.GetUser(user.ID)
+	if err != nil || deleted != nil {
+		t.Errorf("GetUser after DeleteUser = %+v, %v, want nil, nil", deleted, err)
+	}
+}
+
+func testRefreshTokens(t *testing.T, db database.Repository) {
+	user := createUser(t, db, "alice@example.com")
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	token, err := db.CreateRefreshToken(database.CreateRefreshTokenParams{
+		Token:     "token-1",
+		UserID:    user.ID,
+		ExpiresAt: expires,
+	})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if token.Token != "token-1" || token.UserID != user.ID || token.RevokedAt != nil {
+		t.Errorf("CreateRefreshToken returned %+v", token)
+	}
+	if !token.ExpiresAt.Equal(expires) {
+		t.Errorf("ExpiresAt = %v, want %v", token.ExpiresAt, expires)
+	}
+
+	owner, err := db.GetUserByRefreshToken("token-1")
+	if err != nil || owner == nil || owner.ID != user.ID {
+		t.Errorf("GetUserByRefreshToken = %+v, %v", owner, err)
+	}
+	nobody, err := db.GetUserByRefreshToken("unknown")
+	if err != nil || nobody != nil {
+		t.Errorf("GetUserByRefreshToken of an unknown token = %+v, %v, want nil, nil", nobody, err)
+	}
+
+	if err := db.RevokeRefreshToken("token-1"); err != nil {
+		t.Fatalf("RevokeRefreshToken: %v", err)
+	}
+	revoked, err := db.GetRefreshToken("token-1")
+	if err != nil || revoked.RevokedAt == nil {
+		t.Errorf("GetRefreshToken after RevokeRefreshToken = %+v, %v, want revoked_at set", revoked, err)
+	}
+
+	if err := db.DeleteRefreshToken("token-1"); err != nil {
+		t.Fatalf("DeleteRefreshToken: %v", err)
+	}
+	gone, err := db.GetRefreshToken("token-1")
+	if err != nil || gone.Token != "" {
+		t.Errorf("GetRefreshToken after DeleteRefreshToken = %+v, %v, want a zero token", gone, err)
+	}
+}
+
+func testVideos(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+	bob := createUser(t, db, "bob@example.com")
+
+	first, err := db.CreateVideo(database.CreateVideoParams{Title: "First", Description: "one", UserID: alice.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	if first.ID == uuid.Nil || first.Title != "First" || first.Description != "one" || first.UserID != alice.ID {
+		t.Errorf("CreateVideo returned %+v", first)
+	}
+	if first.VideoURL != nil || first.Thumbnails == nil || first.Captions == nil {
+		t.Errorf("new video should have no file and empty media lists: %+v", first)
+	}
+
+	// created_at has second precision on SQLite, so the listing order is
+	// only defined once the clock has moved on
+	time.Sleep(1100 * time.Millisecond)
+	second, err := db.CreateVideo(database.CreateVideoParams{Title: "Second", UserID: alice.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	if _, err := db.CreateVideo(database.CreateVideoParams{Title: "Bob's", UserID: bob.ID}); err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+
+	videos, err := db.GetVideos(alice.ID)
+	if err != nil {
+		t.Fatalf("GetVideos: %v", err)
+	}
+	if len(videos) != 2 || videos[0].ID != second.ID || videos[1].ID != first.ID {
+		t.Errorf("GetVideos should return the user's videos, newest first, got %d", len(videos))
+	}
+
+	url := "bucket,landscape/video.mp4"
+	first.VideoURL = &url
+	first.Title = "Renamed"
+	first.Audio = &database.AudioRendition{AudioURL: "bucket,landscape/video.audio.m4a", DurationSeconds: 12.5}
+	first.StrippedMetadata = []string{"format:location"}
+	if err := db.UpdateVideo(first); err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	updated, err := db.GetVideo(first.ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	if updated.Title != "Renamed" || updated.VideoURL == nil || *updated.VideoURL != url {
+		t.Errorf("UpdateVideo didn't store the title and file: %+v", updated)
+	}
+	if updated.Audio == nil || updated.Audio.DurationSeconds != 12.5 {
+		t.Errorf("UpdateVideo didn't store the audio rendition: %+v", updated.Audio)
+	}
+	if len(updated.StrippedMetadata) != 1 || updated.StrippedMetadata[0] != "format:location" {
+		t.Errorf("UpdateVideo didn't store the stripped metadata: %v", updated.StrippedMetadata)
+	}
+
+	if err := db.DeleteVideo(first.ID); err != nil {
+		t.Fatalf("DeleteVideo: %v", err)
+	}
+	missing, err := db.GetVideo(first.ID)
+	if err != nil || missing.ID != uuid.Nil {
+		t.Errorf("GetVideo after DeleteVideo = %+v, %v, want a zero video", missing, err)
+	}
+}
+
+func testVideoVersions(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+
+	id := uuid.New()
+	clip, err := db.CreateVideoWithVersion(id, database.CreateVideoParams{Title: "Clip", UserID: alice.ID}, database.CreateVideoVersionParams{
+		Source:    database.VersionSourceClip,
+		VideoURL:  "bucket,landscape/clip.mp4",
+		SizeBytes: 100,
+	}, database.QuotaLimits{})
+	if err != nil {
+		t.Fatalf("CreateVideoWithVersion: %v", err)
+	}
+	if clip.ID != id || clip.VideoURL == nil || *clip.VideoURL != "bucket,landscape/clip.mp4" || clip.CurrentVersionID == nil {
+		t.Errorf("CreateVideoWithVersion = %+v, want the video with its version current", clip)
+	}
+	versions, err := db.GetVideoVersions(id)
+	if err != nil || len(versions) != 1 || versions[0].Number != 1 || !versions[0].Current {
+		t.Errorf("GetVideoVersions = %+v, %v, want version 1, current", versions, err)
+	}
+
+	// Nothing is left behind when any part of it fails
+	failedID := uuid.New()
+	tooMany := make([]string, 21)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag %d", i)
+	}
+	_, err = db.CreateVideoWithVersion(failedID, database.CreateVideoParams{Title: "Failed", UserID: alice.ID, Tags: tooMany}, database.CreateVideoVersionParams{
+		Source:   database.VersionSourceClip,
+		VideoURL: "bucket,landscape/failed.mp4",
+	}, database.QuotaLimits{})
+	if !errors.Is(err, database.ErrInvalidTags) {
+		t.Errorf("CreateVideoWithVersion with too many tags = %v, want ErrInvalidTags", err)
+	}
+	if failed, err := db.GetVideo(failedID); err != nil || failed.ID != uuid.Nil {
+		t.Errorf("GetVideo after a failed CreateVideoWithVersion = %+v, %v, want a zero video", failed, err)
+	}
+
+	limits := database.QuotaLimits{MaxBytes: 350, MaxVideos: 1}
+	_, err = db.CreateVideoWithVersion(uuid.New(), database.CreateVideoParams{Title: "Over", UserID: alice.ID}, database.CreateVideoVersionParams{
+		Source:   database.VersionSourceClip,
+		VideoURL: "bucket,landscape/over.mp4",
+	}, limits)
+	if !errors.Is(err, database.ErrQuotaExceeded) {
+		t.Errorf("CreateVideoWithVersion past MaxVideos = %v, want ErrQuotaExceeded", err)
+	}
+
+	// Concurrent uploads only get the room that is left between them
+	results := make(chan error, 5)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			_, err := db.CreateVideoVersion(database.CreateVideoVersionParams{
+				VideoID:   id,
+				Source:    database.VersionSourceUpload,
+				VideoURL:  fmt.Sprintf("bucket,landscape/upload-%d.mp4", i),
+				SizeBytes: 100,
+			}, limits)
+			results <- err
+		}()
+	}
+	stored := 0
+	for i := 0; i < cap(results); i++ {
+		err := <-results
+		switch {
+		case err == nil:
+			stored++
+		case !errors.Is(err, database.ErrQuotaExceeded):
+			t.Errorf("concurrent CreateVideoVersion: %v", err)
+		}
+	}
+	usage, err := db.GetUsage(alice.ID)
+	if err != nil {
+		t.Fatalf("GetUsage: %v", err)
+	}
+	if stored != 2 || usage.Bytes != 300 {
+		t.Errorf("concurrent CreateVideoVersion stored %d versions, %d bytes in all, want 2 and 300", stored, usage.Bytes)
+	}
+
+	// Versions backfilled from before sizes were recorded have none
+	unsized, err := db.CreateVideoVersion(database.CreateVideoVersionParams{
+		VideoID:  id,
+		Source:   database.VersionSourceUpload,
+		VideoURL: "bucket,landscape/legacy.mp4",
+	}, database.QuotaLimits{})
+	if err != nil {
+		t.Fatalf("CreateVideoVersion: %v", err)
+	}
+	versions, err = db.GetUnsizedVideoVersions()
+	if err != nil || len(versions) != 1 || versions[0].ID != unsized.ID {
+		t.Errorf("GetUnsizedVideoVersions = %+v, %v, want the version without a size", versions, err)
+	}
+	if err := db.SetVideoVersionSize(unsized.ID, 50); err != nil {
+		t.Fatalf("SetVideoVersionSize: %v", err)
+	}
+	versions, err = db.GetUnsizedVideoVersions()
+	if err != nil || len(versions) != 0 {
+		t.Errorf("GetUnsizedVideoVersions after SetVideoVersionSize = %+v, %v, want none", versions, err)
+	}
+	if usage, err := db.GetUsage(alice.ID); err != nil || usage.Bytes != 350 {
+		t.Errorf("GetUsage after SetVideoVersionSize = %+v, %v, want 350 bytes", usage, err)
+	}
+}
+
+func testVideoPages(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+	bob := createUser(t, db, "bob@example.com")
+	if _, err := db.CreateVideo(database.CreateVideoParams{Title: "b", UserID: bob.ID}); err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+
+	titles := []string{"e", "a", "d", "b", "c"}
+	for _, title := range titles {
+		video, err := db.CreateVideo(database.CreateVideoParams{Title: title, UserID: alice.ID})
+		if err != nil {
+			t.Fatalf("CreateVideo: %v", err)
+		}
+		if title == "a" || title == "d" {
+			url := "bucket,portrait/" + title + ".mp4"
+			video.VideoURL = &url
+			if err := db.UpdateVideo(video); err != nil {
+				t.Fatalf("UpdateVideo: %v", err)
+			}
+		}
+	}
+
+	got := ""
+	opts := database.VideoListOptions{Limit: 2, Sort: "title"}
+	for pages := 0; ; pages++ {
+		if pages > len(titles) {
+			t.Fatalf("paging didn't end")
+		}
+		page, err := db.GetVideoPage(alice.ID, opts)
+		if err != nil {
+			t.Fatalf("GetVideoPage: %v", err)
+		}
+		if page.Total != len(titles) {
+			t.Errorf("Total = %d, want %d", page.Total, len(titles))
+		}
+		for _, video := range page.Videos {
+			got += video.Title
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		opts.Cursor = *page.NextCursor
+	}
+	if got != "abcde" {
+		t.Errorf("pages by title = %q, want %q", got, "abcde")
+	}
+
+	page, err := db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 10, Sort: "-title"})
+	if err != nil || len(page.Videos) != 5 || page.Videos[0].Title != "e" || page.NextCursor != nil {
+		t.Errorf("GetVideoPage by -title = %+v, %v", page, err)
+	}
+
+	hasVideo := true
+	page, err = db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 10, Sort: "title", HasVideo: &hasVideo})
+	if err != nil || page.Total != 2 || len(page.Videos) != 2 || page.Videos[0].Title != "a" {
+		t.Errorf("GetVideoPage with a video = %+v, %v, want a and d", page, err)
+	}
+	page, err = db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 10, AspectRatio: "landscape"})
+	if err != nil || page.Total != 0 {
+		t.Errorf("GetVideoPage of landscape videos = %+v, %v, want none", page, err)
+	}
+	page, err = db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 10, AspectRatio: "portrait"})
+	if err != nil || page.Total != 2 {
+		t.Errorf("GetVideoPage of portrait videos = %+v, %v, want 2", page, err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	page, err = db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 10, CreatedAfter: &future})
+	if err != nil || page.Total != 0 {
+		t.Errorf("GetVideoPage created after an hour from now = %+v, %v, want none", page, err)
+	}
+	past := time.Now().Add(-time.Hour)
+	page, err = db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 10, CreatedAfter: &past})
+	if err != nil || page.Total != 5 {
+		t.Errorf("GetVideoPage created in the last hour = %+v, %v, want 5", page, err)
+	}
+
+	first, err := db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 1, Sort: "title"})
+	if err != nil || first.NextCursor == nil {
+		t.Fatalf("GetVideoPage: %+v, %v", first, err)
+	}
+	_, err = db.GetVideoPage(alice.ID, database.VideoListOptions{Limit: 1, Sort: "-created_at", Cursor: *first.NextCursor})
+	if !errors.Is(err, database.ErrInvalidCursor) {
+		t.Errorf("GetVideoPage with another sort's cursor = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func testSearch(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+	bob := createUser(t, db, "bob@example.com")
+
+	videos := []database.CreateVideoParams{
+		{Title: "Boots review", Description: "Hiking in the mountains", UserID: alice.ID},
+		{Title: "Mountain biking", Description: "Downhill <fast> runs", UserID: alice.ID},
+		{Title: "Cooking pasta", Description: "Nothing to see here", UserID: alice.ID},
+		{Title: "Mountain secrets", Description: "Bob's mountain video", UserID: bob.ID},
+	}
+	for _, params := range videos {
+		if _, err := db.CreateVideo(params); err != nil {
+			t.Fatalf("CreateVideo: %v", err)
+		}
+	}
+
+	page, err := db.SearchVideos(alice.ID, database.SearchTerms("mountain"), 10, "")
+	if err != nil {
+		t.Fatalf("SearchVideos: %v", err)
+	}
+	if page.Total != 2 || len(page.Results) != 2 {
+		t.Fatalf("SearchVideos(mountain) found %d, want alice's 2", page.Total)
+	}
+	if page.Results[0].Title != "Mountain biking" {
+		t.Errorf("a title match should rank first, got %q", page.Results[0].Title)
+	}
+	if page.Results[0].TitleHighlight != "<mark>Mountain</mark> biking" {
+		t.Errorf("TitleHighlight = %q", page.Results[0].TitleHighlight)
+	}
+	if page.Results[0].Snippet != "Downhill &lt;fast&gt; runs" {
+		t.Errorf("Snippet = %q, want it HTML escaped", page.Results[0].Snippet)
+	}
+
+	page, err = db.SearchVideos(alice.ID, database.SearchTerms("hiking mount"), 10, "")
+	if err != nil || page.Total != 1 || page.Results[0].Title != "Boots review" {
+		t.Errorf("SearchVideos(hiking mount) = %+v, %v, want the boots review", page, err)
+	}
+
+	page, err = db.SearchVideos(alice.ID, database.SearchTerms("mountain"), 1, "")
+	if err != nil || len(page.Results) != 1 || page.NextCursor == nil {
+		t.Fatalf("SearchVideos with limit 1 = %+v, %v", page, err)
+	}
+	next, err := db.SearchVideos(alice.ID, database.SearchTerms("mountain"), 1, *page.NextCursor)
+	if err != nil || len(next.Results) != 1 || next.NextCursor != nil || next.Results[0].ID == page.Results[0].ID {
+		t.Errorf("second page of SearchVideos = %+v, %v", next, err)
+	}
+
+	renamed, err := db.GetVideo(page.Results[0].ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	renamed.Title = "Valley biking"
+	if err := db.UpdateVideo(renamed); err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	page, err = db.SearchVideos(alice.ID, database.SearchTerms("valley"), 10, "")
+	if err != nil || page.Total != 1 {
+		t.Errorf("SearchVideos doesn't see a renamed title: %+v, %v", page, err)
+	}
+	if err := db.DeleteVideo(renamed.ID); err != nil {
+		t.Fatalf("DeleteVideo: %v", err)
+	}
+	page, err = db.SearchVideos(alice.ID, database.SearchTerms("valley"), 10, "")
+	if err != nil || page.Total != 0 {
+		t.Errorf("SearchVideos still finds a deleted video: %+v, %v", page, err)
+	}
+}
+
+func testUserQuotas(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+
+	missing, err := db.GetUserQuota(alice.ID)
+	if err != nil || missing != nil {
+		t.Errorf("GetUserQuota without overrides = %+v, %v, want nil", missing, err)
+	}
+
+	maxBytes := int64(1 << 30)
+	quota, err := db.UpsertUserQuota(database.UserQuota{UserID: alice.ID, MaxBytes: &maxBytes})
+	if err != nil {
+		t.Fatalf("UpsertUserQuota: %v", err)
+	}
+	if quota.UserID != alice.ID || quota.MaxBytes == nil || *quota.MaxBytes != maxBytes || quota.MaxVideos != nil {
+		t.Errorf("UpsertUserQuota = %+v", quota)
+	}
+	maxVideos := 3
+	quota, err = db.UpsertUserQuota(database.UserQuota{UserID: alice.ID, MaxVideos: &maxVideos})
+	if err != nil || quota.MaxBytes != nil || quota.MaxVideos == nil || *quota.MaxVideos != maxVideos {
+		t.Errorf("UpsertUserQuota over an existing one = %+v, %v", quota, err)
+	}
+
+	if err := db.DeleteUserQuota(alice.ID); err != nil {
+		t.Fatalf("DeleteUserQuota: %v", err)
+	}
+	if deleted, err := db.GetUserQuota(alice.ID); err != nil || deleted != nil {
+		t.Errorf("GetUserQuota after DeleteUserQuota = %+v, %v, want nil", deleted, err)
+	}
+}
+
+func testWatermarks(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+
+	missing, err := db.GetWatermark(alice.ID)
+	if err != nil || missing != nil {
+		t.Errorf("GetWatermark without one = %+v, %v, want nil", missing, err)
+	}
+
+	watermark, err := db.UpsertWatermark(database.Watermark{UserID: alice.ID, ImagePath: "a.png", Position: "top-left", Opacity: 0.5, Scale: 0.2})
+	if err != nil {
+		t.Fatalf("UpsertWatermark: %v", err)
+	}
+	if watermark.UserID != alice.ID || watermark.ImagePath != "a.png" || watermark.Opacity != 0.5 {
+		t.Errorf("UpsertWatermark = %+v", watermark)
+	}
+	watermark, err = db.UpsertWatermark(database.Watermark{UserID: alice.ID, ImagePath: "b.png", Position: "bottom-right", Opacity: 1, Scale: 0.1})
+	if err != nil || watermark.ImagePath != "b.png" || watermark.Position != "bottom-right" {
+		t.Errorf("UpsertWatermark over an existing one = %+v, %v", watermark, err)
+	}
+
+	if err := db.DeleteWatermark(alice.ID); err != nil {
+		t.Fatalf("DeleteWatermark: %v", err)
+	}
+	if deleted, err := db.GetWatermark(alice.ID); err != nil || deleted != nil {
+		t.Errorf("GetWatermark after DeleteWatermark = %+v, %v, want nil", deleted, err)
+	}
+}
+
+func testTrash(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+	kept, err := db.CreateVideo(database.CreateVideoParams{Title: "Kept", UserID: alice.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	trashed, err := db.CreateVideo(database.CreateVideoParams{Title: "Trashed", UserID: alice.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	if err := db.TrashVideo(trashed.ID); err != nil {
+		t.Fatalf("TrashVideo: %v", err)
+	}
+
+	video, err := db.GetVideo(trashed.ID)
+	if err != nil || video.DeletedAt == nil {
+		t.Fatalf("GetVideo of a trashed video = %+v, %v, want it with DeletedAt", video, err)
+	}
+	if videos, err := db.GetVideos(alice.ID); err != nil || len(videos) != 1 || videos[0].ID != kept.ID {
+		t.Errorf("GetVideos lists trashed videos: %d, %v", len(videos), err)
+	}
+	if page, err := db.GetVideoPage(alice.ID, database.VideoListOptions{}); err != nil || page.Total != 1 {
+		t.Errorf("GetVideoPage counts trashed videos: %d, %v", page.Total, err)
+	}
+	if page, err := db.SearchVideos(alice.ID, database.SearchTerms("trashed"), 10, ""); err != nil || page.Total != 0 {
+		t.Errorf("SearchVideos finds trashed videos: %d, %v", page.Total, err)
+	}
+	if videos, err := db.GetTrashedVideos(alice.ID); err != nil || len(videos) != 1 || videos[0].ID != trashed.ID {
+		t.Errorf("GetTrashedVideos = %d videos, %v, want the trashed one", len(videos), err)
+	}
+
+	// deleted_at has second precision on SQLite
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	if videos, err := db.GetVideosTrashedBefore(past); err != nil || len(videos) != 0 {
+		t.Errorf("GetVideosTrashedBefore an hour ago = %d videos, %v", len(videos), err)
+	}
+	if videos, err := db.GetVideosTrashedBefore(future); err != nil || len(videos) != 1 {
+		t.Errorf("GetVideosTrashedBefore an hour from now = %d videos, %v", len(videos), err)
+	}
+	if purged, err := db.PurgeVideo(kept.ID, future); err != nil || purged {
+		t.Errorf("PurgeVideo deleted a video that isn't in the trash: %v", err)
+	}
+
+	if err := db.RestoreVideo(trashed.ID); err != nil {
+		t.Fatalf("RestoreVideo: %v", err)
+	}
+	if videos, err := db.GetVideos(alice.ID); err != nil || len(videos) != 2 {
+		t.Errorf("GetVideos after RestoreVideo = %d videos, %v, want 2", len(videos), err)
+	}
+	if purged, err := db.PurgeVideo(trashed.ID, future); err != nil || purged {
+		t.Errorf("PurgeVideo deleted a restored video: %v", err)
+	}
+
+	if err := db.TrashVideo(trashed.ID); err != nil {
+		t.Fatalf("TrashVideo: %v", err)
+	}
+	if purged, err := db.PurgeVideo(trashed.ID, future); err != nil || !purged {
+		t.Fatalf("PurgeVideo = %v, %v, want it purged", purged, err)
+	}
+	if video, err := db.GetVideo(trashed.ID); err != nil || video.ID != uuid.Nil {
+		t.Errorf("GetVideo after PurgeVideo = %+v, %v, want a zero video", video, err)
+	}
+}
+
+func testTags(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+	bob := createUser(t, db, "bob@example.com")
+
+	music := "music"
+	tagged, err := db.CreateVideo(database.CreateVideoParams{
+		Title:    "Tagged",
+		UserID:   alice.ID,
+		Tags:     []string{" Live  Music ", "jazz", "live music", ""},
+		Category: &music,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	if len(tagged.Tags) != 2 || tagged.Tags[0] != "jazz" || tagged.Tags[1] != "live music" {
+		t.Errorf("CreateVideo tags = %q, want them normalised", tagged.Tags)
+	}
+	if tagged.Category == nil || *tagged.Category != "music" {
+		t.Errorf("CreateVideo category = %v, want music", tagged.Category)
+	}
+
+	unknown := "knitting"
+	_, err = db.CreateVideo(database.CreateVideoParams{Title: "Unknown", UserID: alice.ID, Category: &unknown})
+	if !errors.Is(err, database.ErrUnknownCategory) {
+		t.Errorf("CreateVideo with an unknown category = %v, want ErrUnknownCategory", err)
+	}
+	if _, err := db.CreateVideo(database.CreateVideoParams{Title: "Untagged", UserID: alice.ID}); err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	if _, err := db.CreateVideo(database.CreateVideoParams{Title: "Bob's", UserID: bob.ID, Tags: []string{"jazz"}}); err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+
+	page, err := db.GetVideoPage(alice.ID, database.VideoListOptions{Tag: "jazz"})
+	if err != nil || page.Total != 1 || page.Videos[0].ID != tagged.ID {
+		t.Errorf("GetVideoPage by tag = %+v, %v, want alice's tagged video", page, err)
+	}
+	page, err = db.GetVideoPage(alice.ID, database.VideoListOptions{Category: "music"})
+	if err != nil || page.Total != 1 {
+		t.Errorf("GetVideoPage by category found %d, %v, want 1", page.Total, err)
+	}
+
+	if err := db.SetVideoTags(tagged.ID, []string{"jazz", "piano"}); err != nil {
+		t.Fatalf("SetVideoTags: %v", err)
+	}
+	tags, err := db.GetUserTags(alice.ID)
+	if err != nil || len(tags) != 2 || tags[0] != (database.TagCount{Name: "jazz", Count: 1}) {
+		t.Errorf("GetUserTags = %+v, %v, want jazz and piano once each", tags, err)
+	}
+	tooMany := make([]string, 21)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag %d", i)
+	}
+	if err := db.SetVideoTags(tagged.ID, tooMany); !errors.Is(err, database.ErrInvalidTags) {
+		t.Errorf("SetVideoTags with 21 tags = %v, want ErrInvalidTags", err)
+	}
+
+	if err := db.SetVideoCategory(tagged.ID, nil); err != nil {
+		t.Fatalf("SetVideoCategory: %v", err)
+	}
+	video, err := db.GetVideo(tagged.ID)
+	if err != nil || video.Category != nil || len(video.Tags) != 2 {
+		t.Errorf("GetVideo after clearing the category = %+v, %v", video, err)
+	}
+
+	categories, err := db.GetCategories()
+	if err != nil || len(categories) == 0 {
+		t.Errorf("GetCategories = %v, %v, want the category list", categories, err)
+	}
+}
+
+func testPlaylists(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+	videos := make([]database.Video, 5)
+	for i := range videos {
+		video, err := db.CreateVideo(database.CreateVideoParams{Title: fmt.Sprintf("Video %d", i), UserID: alice.ID})
+		if err != nil {
+			t.Fatalf("CreateVideo: %v", err)
+		}
+		videos[i] = video
+	}
+
+	playlist, err := db.CreatePlaylist(database.CreatePlaylistParams{
+		UserID:     alice.ID,
+		Title:      "Favourites",
+		Visibility: database.PlaylistPrivate,
+	})
+	if err != nil {
+		t.Fatalf("CreatePlaylist: %v", err)
+	}
+
+	order := func() []uuid.UUID {
+		t.Helper()
+		videos, err := db.GetPlaylistVideos(playlist.ID)
+		if err != nil {
+			t.Fatalf("GetPlaylistVideos: %v", err)
+		}
+		ids := make([]uuid.UUID, len(videos))
+		for i, video := range videos {
+			ids[i] = video.ID
+		}
+		return ids
+	}
+	sameOrder := func(got []uuid.UUID, want ...database.Video) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i].ID {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, video := range videos[:3] {
+		if err := db.AddPlaylistVideo(playlist.ID, video.ID, 100); err != nil {
+			t.Fatalf("AddPlaylistVideo: %v", err)
+		}
+	}
+	if err := db.AddPlaylistVideo(playlist.ID, videos[3].ID, 0); err != nil {
+		t.Fatalf("AddPlaylistVideo: %v", err)
+	}
+	if got := order(); !sameOrder(got, videos[3], videos[0], videos[1], videos[2]) {
+		t.Errorf("AddPlaylistVideo didn't insert at the position")
+	}
+	if err := db.AddPlaylistVideo(playlist.ID, videos[0].ID, 0); !errors.Is(err, database.ErrVideoInPlaylist) {
+		t.Errorf("AddPlaylistVideo of a video already there = %v, want ErrVideoInPlaylist", err)
+	}
+
+	if err := db.RemovePlaylistVideo(playlist.ID, videos[0].ID); err != nil {
+		t.Fatalf("RemovePlaylistVideo: %v", err)
+	}
+	if got := order(); !sameOrder(got, videos[3], videos[1], videos[2]) {
+		t.Errorf("RemovePlaylistVideo left the wrong order")
+	}
+
+	if err := db.TrashVideo(videos[1].ID); err != nil {
+		t.Fatalf("TrashVideo: %v", err)
+	}
+	got, err := db.GetPlaylist(playlist.ID)
+	if err != nil || got.VideoCount != 2 {
+		t.Errorf("GetPlaylist counts trashed videos: %+v, %v", got, err)
+	}
+	err = db.ReorderPlaylist(playlist.ID, []uuid.UUID{videos[2].ID, videos[2].ID})
+	if !errors.Is(err, database.ErrPlaylistOrder) {
+		t.Errorf("ReorderPlaylist with a duplicate = %v, want ErrPlaylistOrder", err)
+	}
+	if err := db.ReorderPlaylist(playlist.ID, []uuid.UUID{videos[2].ID, videos[3].ID}); err != nil {
+		t.Fatalf("ReorderPlaylist: %v", err)
+	}
+	if err := db.RestoreVideo(videos[1].ID); err != nil {
+		t.Fatalf("RestoreVideo: %v", err)
+	}
+	if got := order(); !sameOrder(got, videos[2], videos[3], videos[1]) {
+		t.Errorf("ReorderPlaylist should put trashed videos last")
+	}
+
+	if err := db.TrashVideo(videos[3].ID); err != nil {
+		t.Fatalf("TrashVideo: %v", err)
+	}
+	if err := db.AddPlaylistVideo(playlist.ID, videos[4].ID, 2); err != nil {
+		t.Fatalf("AddPlaylistVideo: %v", err)
+	}
+	if got := order(); !sameOrder(got, videos[2], videos[1], videos[4]) {
+		t.Errorf("AddPlaylistVideo should count positions among the videos shown")
+	}
+	if err := db.AddPlaylistVideo(playlist.ID, videos[3].ID, 0); !errors.Is(err, database.ErrVideoInPlaylist) {
+		t.Errorf("AddPlaylistVideo of a trashed video already there = %v, want ErrVideoInPlaylist", err)
+	}
+	if err := db.RemovePlaylistVideo(playlist.ID, videos[4].ID); err != nil {
+		t.Fatalf("RemovePlaylistVideo: %v", err)
+	}
+	if err := db.RestoreVideo(videos[3].ID); err != nil {
+		t.Fatalf("RestoreVideo: %v", err)
+	}
+	if got := order(); !sameOrder(got, videos[2], videos[3], videos[1]) {
+		t.Errorf("restoring a video should put it back where it was")
+	}
+
+	playlist.Title = "Renamed"
+	playlist.Visibility = database.PlaylistPublic
+	if err := db.UpdatePlaylist(playlist); err != nil {
+		t.Fatalf("UpdatePlaylist: %v", err)
+	}
+	playlists, err := db.GetPlaylists(alice.ID)
+	if err != nil || len(playlists) != 1 || playlists[0].Title != "Renamed" || playlists[0].Visibility != database.PlaylistPublic {
+		t.Errorf("GetPlaylists = %+v, %v, want the renamed playlist", playlists, err)
+	}
+	unlisted, err := db.CreatePlaylist(database.CreatePlaylistParams{UserID: alice.ID, Title: "Drafts", Visibility: database.PlaylistUnlisted})
+	if err != nil {
+		t.Fatalf("CreatePlaylist: %v", err)
+	}
+	playlists, err = db.GetPublicPlaylists(alice.ID)
+	if err != nil || len(playlists) != 1 || playlists[0].ID != playlist.ID {
+		t.Errorf("GetPublicPlaylists = %+v, %v, want only the public playlist", playlists, err)
+	}
+	if err := db.DeletePlaylist(unlisted.ID); err != nil {
+		t.Fatalf("DeletePlaylist: %v", err)
+	}
+
+	if err := db.DeleteVideo(videos[2].ID); err != nil {
+		t.Fatalf("DeleteVideo: %v", err)
+	}
+	if got := order(); len(got) != 2 {
+		t.Errorf("a deleted video stays in the playlist")
+	}
+	if err := db.DeletePlaylist(playlist.ID); err != nil {
+		t.Fatalf("DeletePlaylist: %v", err)
+	}
+	if got, err := db.GetPlaylist(playlist.ID); err != nil || got.ID != uuid.Nil {
+		t.Errorf("GetPlaylist after DeletePlaylist = %+v, %v, want a zero playlist", got, err)
+	}
+	if video, err := db.GetVideo(videos[3].ID); err != nil || video.ID == uuid.Nil {
+		t.Errorf("DeletePlaylist deleted its videos")
+	}
+}
+
+func testVideoDetails(t *testing.T, db database.Repository) {
+	alice := createUser(t, db, "alice@example.com")
+	video, err := db.CreateVideo(database.CreateVideoParams{Title: "Draft", Description: "Kept", UserID: alice.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+
+	title := "Final"
+	tags := []string{"done"}
+	err = db.UpdateVideoDetails(video.ID, database.VideoDetails{Title: &title, Tags: &tags}, &video.Version)
+	if err != nil {
+		t.Fatalf("UpdateVideoDetails: %v", err)
+	}
+	updated, err := db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	if updated.Title != "Final" || updated.Description != "Kept" || len(updated.Tags) != 1 {
+		t.Errorf("UpdateVideoDetails = %+v, want the title and tags changed and the rest kept", updated)
+	}
+	if updated.Version != video.Version+1 {
+		t.Errorf("UpdateVideoDetails didn't bump the version: %d, then %d", video.Version, updated.Version)
+	}
+
+	// Within the same second as the first update, which updated_at can't tell apart
+	title = "Stale"
+	err = db.UpdateVideoDetails(video.ID, database.VideoDetails{Title: &title}, &video.Version)
+	if !errors.Is(err, database.ErrVideoModified) {
+		t.Errorf("UpdateVideoDetails with a stale version = %v, want ErrVideoModified", err)
+	}
+
+	if err := db.UpdateVideo(updated); err != nil {
+		t.Fatalf("UpdateVideo: %v", err)
+	}
+	again, err := db.GetVideo(video.ID)
+	if err != nil || again.Version != updated.Version+1 {
+		t.Errorf("UpdateVideo didn't bump the version: %d, then %d (%v)", updated.Version, again.Version, err)
+	}
+	err = db.UpdateVideoDetails(video.ID, database.VideoDetails{Title: &title}, &updated.Version)
+	if !errors.Is(err, database.ErrVideoModified) {
+		t.Errorf("UpdateVideoDetails after UpdateVideo = %v, want ErrVideoModified", err)
+	}
+
+	err = db.ReplaceVideoThumbnails(video.ID, []database.Thumbnail{{URL: "/assets/thumb.webp", Width: 320, MimeType: "image/webp"}})
+	if err != nil {
+		t.Fatalf("ReplaceVideoThumbnails: %v", err)
+	}
+	withThumbnail, err := db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	if withThumbnail.Title != again.Title || len(withThumbnail.Thumbnails) != 1 || withThumbnail.Version != again.Version+1 {
+		t.Errorf("ReplaceVideoThumbnails = %+v, want one thumbnail, the details kept and the version bumped", withThumbnail)
+	}
+}
+
+func testAuditEvents(t *testing.T, db database.Repository) {
+	// Reset keeps the audit log, so everything is filtered by actor
+	alice, bob := uuid.New(), uuid.New()
+	videoID := uuid.New().String()
+	events := []database.AuditEvent{
+		{Action: database.AuditLogin, ActorID: &alice, TargetType: database.AuditTargetUser, TargetID: alice.String(), IP: "192.0.2.1", UserAgent: "test"},
+		{Action: database.AuditVideoCreate, ActorID: &alice, TargetType: database.AuditTargetVideo, TargetID: videoID},
+		{Action: database.AuditVideoDelete, ActorID: &alice, TargetType: database.AuditTargetVideo, TargetID: videoID, Details: map[string]string{"title": "Boots"}},
+		{Action: database.AuditLogin, ActorID: &bob, TargetType: database.AuditTargetUser, TargetID: bob.String()},
+	}
+	for _, event := range events {
+		if err := db.CreateAuditEvent(event); err != nil {
+			t.Fatalf("CreateAuditEvent: %v", err)
+		}
+	}
+
+	got, err := db.GetAuditEvents(database.AuditEventFilter{ActorID: &alice})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	if len(got) != 3 || got[0].Action != database.AuditVideoDelete || got[2].Action != database.AuditLogin {
+		t.Fatalf("GetAuditEvents by actor = %+v, want alice's 3 events newest first", got)
+	}
+	if got[0].Details["title"] != "Boots" || got[2].IP != "192.0.2.1" || got[2].UserAgent != "test" {
+		t.Errorf("GetAuditEvents didn't keep the details, IP and user agent: %+v", got)
+	}
+
+	page, err := db.GetAuditEvents(database.AuditEventFilter{ActorID: &alice, Limit: 2})
+	if err != nil || len(page) != 2 {
+		t.Fatalf("GetAuditEvents with limit 2 = %d events, %v", len(page), err)
+	}
+	rest, err := db.GetAuditEvents(database.AuditEventFilter{ActorID: &alice, BeforeID: page[1].ID})
+	if err != nil || len(rest) != 1 || rest[0].ID != got[2].ID {
+		t.Errorf("GetAuditEvents before the first page = %+v, %v", rest, err)
+	}
+
+	targeted, err := db.GetAuditEvents(database.AuditEventFilter{TargetType: database.AuditTargetVideo, TargetID: videoID, Oldest: true})
+	if err != nil || len(targeted) != 2 || targeted[0].Action != database.AuditVideoCreate {
+		t.Errorf("GetAuditEvents by target, oldest first = %+v, %v", targeted, err)
+	}
+
+	count := 0
+	err = db.EachAuditEvent(database.AuditEventFilter{Action: database.AuditLogin, ActorID: &bob, Limit: -1}, func(event database.AuditEvent) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 1 {
+		t.Errorf("EachAuditEvent by action and actor saw %d events, %v", count, err)
+	}
+}
+
+func testForeignKeys(t *testing.T, db database.Repository) {
+	_, err := db.CreateRefreshToken(database.CreateRefreshTokenParams{
+		Token:     "orphan",
+		UserID:    uuid.New(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err == nil {
+		t.Errorf("CreateRefreshToken accepted a user that doesn't exist")
+	}
+	if _, err := db.CreateVideo(database.CreateVideoParams{Title: "Orphan", UserID: uuid.New()}); err == nil {
+		t.Errorf("CreateVideo accepted a user that doesn't exist")
+	}
+
+	alice := createUser(t, db, "alice@example.com")
+	bob := createUser(t, db, "bob@example.com")
+	for _, user := range []*database.User{alice, bob} {
+		_, err := db.CreateRefreshToken(database.CreateRefreshTokenParams{
+			Token:     "token-" + user.Email,
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken: %v", err)
+		}
+		if _, err := db.CreateVideo(database.CreateVideoParams{Title: "Video", UserID: user.ID}); err != nil {
+			t.Fatalf("CreateVideo: %v", err)
+		}
+	}
+
+	if err := db.DeleteUser(alice.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if token, err := db.GetRefreshToken("token-" + alice.Email); err != nil || token.Token != "" {
+		t.Errorf("DeleteUser left the user's refresh token: %+v, %v", token, err)
+	}
+	if videos, err := db.GetVideos(alice.ID); err != nil || len(videos) != 0 {
+		t.Errorf("DeleteUser left %d of the user's videos, %v", len(videos), err)
+	}
+
+	if token, err := db.GetRefreshToken("token-" + bob.Email); err != nil || token.Token == "" {
+		t.Errorf("DeleteUser removed another user's refresh token: %v", err)
+	}
+	if videos, err := db.GetVideos(bob.ID); err != nil || len(videos) != 1 {
+		t.Errorf("DeleteUser removed another user's videos: %d left, %v", len(videos), err)
+	}
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// A dialect is one of the database engines the client runs on. Queries
+// are written once, with ? placeholders, in the SQL both engines share.
+type dialect interface {
+	// driver is the database/sql driver name
+	driver() string
+	// name is the directory under migrations/ with the dialect's schema
+	name() string
+	rebind(query string) string
+	tableExistsQuery() string
+	// timeValue is how to pass a time to compare with a TIMESTAMP column
+	timeValue(t time.Time) any
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) driver() string { return "sqlite3" }
+
+func (sqliteDialect) name() string { return "sqlite" }
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) tableExistsQuery() string {
+	return `SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+
+// SQLite keeps timestamps as text, in CURRENT_TIMESTAMP's format when the
+// database filled them in, and compares them as text.
+func (sqliteDialect) timeValue(t time.Time) any {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) driver() string { return "postgres" }
+
+func (postgresDialect) name() string { return "postgres" }
+
+// rebind numbers the placeholders $1, $2, ... skipping string literals.
+func (postgresDialect) rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (postgresDialect) tableExistsQuery() string {
+	return `SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+}
+
+func (postgresDialect) timeValue(t time.Time) any { return t }
+
+// dialectFor picks the engine from the DB_URL/DB_PATH value. postgres://
+// and postgresql:// URLs go to Postgres, anything else is a SQLite path,
+// optionally written as sqlite://path.
+func dialectFor(dsn string) (dialect, string) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return postgresDialect{}, dsn
+	}
+	for _, scheme := range []string{"sqlite3://", "sqlite://"} {
+		if path, ok := strings.CutPrefix(dsn, scheme); ok {
+			dsn = path
+			break
+		}
+	}
+	return sqliteDialect{}, withSQLiteForeignKeys(dsn)
+}
+
+// SQLite only enforces foreign keys on connections that turn them on,
+// which the driver does for every connection it opens given this option.
+func withSQLiteForeignKeys(dsn string) string {
+	if strings.Contains(dsn, "_foreign_keys=") || strings.Contains(dsn, "_fk=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=on"
+	}
+	return dsn + "?_foreign_keys=on"
+}
+
+// conn runs every query through the dialect's rebind, so *sql.DB and
+// *sql.Tx can be used as if the engine took ? placeholders.
+type conn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (c *conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.rebind(query), args...)
+}
+
+func (c *conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.rebind(query), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.DB.QueryRow(c.dialect.rebind(query), args...)
+}
+
+func (c *conn) Begin() (*tx, error) {
+	t, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, dialect: c.dialect}, nil
+}
+
+type tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.rebind(query), args...)
+}
+
+func (t *tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.dialect.rebind(query), args...)
+}
+
+func (t *tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.rebind(query), args...)
+}
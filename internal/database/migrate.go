@@ -0,0 +1,375 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// A migration is a pair of migrations/<dialect>/NNNN_name.up.sql and
+// NNNN_name.down.sql files, with the same versions for every dialect.
+// Each step runs in its own transaction together with the schema_version
+// bookkeeping.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is one known migration and whether it has been applied.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// The version databases created before migrations existed are baselined at
+const baselineVersion = 1
+
+// Columns autoMigrate added to tables it had already created. A legacy
+// database may lack any of them, which the baseline's CREATE TABLE IF NOT
+// EXISTS statements don't fix.
+var baselineColumns = []struct {
+	table      string
+	name       string
+	definition string
+}{
+	{"videos", "loudness_measured_lufs", "REAL"},
+	{"videos", "loudness_measured_true_peak", "REAL"},
+	{"videos", "loudness_target_lufs", "REAL"},
+	{"videos", "original_video_url", "TEXT"},
+	{"videos", "preview_url", "TEXT"},
+	{"videos", "current_version_id", "TEXT"},
+	{"videos", "audio_url", "TEXT"},
+	{"videos", "audio_duration_seconds", "REAL"},
+	{"videos", "stripped_metadata", "TEXT"},
+	{"video_versions", "audio_url", "TEXT"},
+	{"video_versions", "audio_duration_seconds", "REAL"},
+	{"video_versions", "size_bytes", "INTEGER"},
+	{"video_versions", "stripped_metadata", "TEXT"},
+}
+
+func loadMigrations(d dialect) ([]migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/"+d.name()+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s migrations", d.name())
+	}
+
+	byVersion := map[int]*migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s is neither .up.sql nor .down.sql", base)
+		}
+
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s isn't named NNNN_name", base)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s has an invalid version", base)
+		}
+
+		contents, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if m.name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.name, name)
+		}
+		if direction == "up" {
+			m.up = string(contents)
+		} else {
+			m.down = string(contents)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down step", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate applies every pending migration.
+func (c Client) Migrate() error {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return err
+	}
+	return c.MigrateTo(len(migrations))
+}
+
+// MigrateTo applies up steps, or rolls back down steps, one transaction
+// each until the database is at the target version. 0 drops everything.
+func (c Client) MigrateTo(target int) error {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("unknown schema version %d, the latest is %d", target, len(migrations))
+	}
+
+	err = c.prepareSchemaVersion()
+	if err != nil {
+		return err
+	}
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database is at schema version %d, newer than this build knows (%d)", current, len(migrations))
+	}
+
+	for current < target {
+		m := migrations[current]
+		err = c.applyMigration(m.up, `INSERT INTO schema_version (version, name) VALUES (?, ?)`, m.version, m.name)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s up: %w", m.version, m.name, err)
+		}
+		current++
+	}
+	for current > target {
+		m := migrations[current-1]
+		err = c.applyMigration(m.down, `DELETE FROM schema_version WHERE version = ?`, m.version)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s down: %w", m.version, m.name, err)
+		}
+		current--
+	}
+	return nil
+}
+
+func (c Client) applyMigration(script, bookkeeping string, args ...any) error {
+	ctx := context.Background()
+	sqlConn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sqlConn.Close()
+
+	// Rebuilding a SQLite table means dropping it while other tables still
+	// point at it, so foreign keys are off for the step and checked once
+	// it's done. The pragma is a no-op inside a transaction.
+	_, sqlite := c.db.dialect.(sqliteDialect)
+	if sqlite {
+		_, err = sqlConn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`)
+		if err != nil {
+			return err
+		}
+		defer sqlConn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+	}
+
+	sqlTx, err := sqlConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := &tx{Tx: sqlTx, dialect: c.db.dialect}
+	defer tx.Rollback()
+
+	// Databases from before foreign keys were enforced can already have
+	// broken references, which a later step cleans up. A step only fails
+	// for the ones it adds.
+	var violationsBefore int
+	if sqlite {
+		violationsBefore, err = foreignKeyViolations(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(script)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(bookkeeping, args...)
+	if err != nil {
+		return err
+	}
+
+	if sqlite {
+		violations, err := foreignKeyViolations(tx)
+		if err != nil {
+			return err
+		}
+		if violations > violationsBefore {
+			return fmt.Errorf("leaves %d rows pointing at missing rows", violations-violationsBefore)
+		}
+	}
+	return tx.Commit()
+}
+
+func foreignKeyViolations(q querier) (int, error) {
+	rows, err := q.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	violations := 0
+	for rows.Next() {
+		violations++
+	}
+	return violations, rows.Err()
+}
+
+// SchemaVersion is the highest applied migration, 0 for an empty database.
+func (c Client) SchemaVersion() (int, error) {
+	var version int
+	err := c.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// MigrationStatus lists every known migration, oldest first.
+func (c Client) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	err = c.prepareSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.version, Name: m.name}
+		if appliedAt, ok := applied[m.version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// prepareSchemaVersion creates the schema_version table. A database that
+// has tables but no schema_version was made by autoMigrate, which only
+// ever ran on SQLite: it's brought up to the baseline schema and recorded
+// as already being there.
+func (c Client) prepareSchemaVersion() error {
+	exists, err := c.tableExists("schema_version")
+	if err != nil || exists {
+		return err
+	}
+	legacy, err := c.tableExists("users")
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(`
+	CREATE TABLE schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.db.dialect.(sqliteDialect); !ok || !legacy {
+		return nil
+	}
+	return c.baselineLegacySchema()
+}
+
+func (c Client) baselineLegacySchema() error {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return err
+	}
+	baseline := migrations[baselineVersion-1]
+
+	// The baseline only uses CREATE TABLE IF NOT EXISTS, so it fills in
+	// tables added after the database was made and leaves the rest alone.
+	_, err = c.db.Exec(baseline.up)
+	if err != nil {
+		return err
+	}
+	for _, column := range baselineColumns {
+		err = c.addColumnIfMissing(column.table, column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.db.Exec(`INSERT INTO schema_version (version, name) VALUES (?, ?)`, baseline.version, baseline.name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c Client) tableExists(name string) (bool, error) {
+	var found string
+	err := c.db.QueryRow(c.db.dialect.tableExistsQuery(), name).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,131 @@
+-- The same schema as SQLite's version 2, with Postgres types.
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT,
+	loudness_measured_lufs DOUBLE PRECISION,
+	loudness_measured_true_peak DOUBLE PRECISION,
+	loudness_target_lufs DOUBLE PRECISION,
+	original_video_url TEXT,
+	preview_url TEXT,
+	current_version_id TEXT,
+	audio_url TEXT,
+	audio_duration_seconds DOUBLE PRECISION,
+	stripped_metadata TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_thumbnails (
+	video_id TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	mime_type TEXT NOT NULL,
+	url TEXT NOT NULL,
+	PRIMARY KEY(video_id, width, mime_type),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_captions (
+	video_id TEXT NOT NULL,
+	language TEXT NOT NULL,
+	label TEXT NOT NULL,
+	caption_url TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, language),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_watermarks (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	image_path TEXT NOT NULL,
+	position TEXT NOT NULL,
+	opacity DOUBLE PRECISION NOT NULL,
+	scale DOUBLE PRECISION NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_storyboards (
+	video_id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	storyboard_url TEXT NOT NULL,
+	sheet_count INTEGER NOT NULL,
+	frame_count INTEGER NOT NULL,
+	interval_seconds DOUBLE PRECISION NOT NULL,
+	duration_seconds DOUBLE PRECISION NOT NULL,
+	columns INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	tile_width INTEGER NOT NULL,
+	tile_height INTEGER NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_versions (
+	id TEXT PRIMARY KEY,
+	video_id TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	source TEXT NOT NULL,
+	video_url TEXT NOT NULL,
+	original_video_url TEXT,
+	preview_url TEXT,
+	loudness_measured_lufs DOUBLE PRECISION,
+	loudness_measured_true_peak DOUBLE PRECISION,
+	loudness_target_lufs DOUBLE PRECISION,
+	audio_url TEXT,
+	audio_duration_seconds DOUBLE PRECISION,
+	size_bytes BIGINT,
+	stripped_metadata TEXT,
+	UNIQUE(video_id, number),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_version_storyboards (
+	version_id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	storyboard_url TEXT NOT NULL,
+	sheet_count INTEGER NOT NULL,
+	frame_count INTEGER NOT NULL,
+	interval_seconds DOUBLE PRECISION NOT NULL,
+	duration_seconds DOUBLE PRECISION NOT NULL,
+	columns INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	tile_width INTEGER NOT NULL,
+	tile_height INTEGER NOT NULL,
+	FOREIGN KEY(version_id) REFERENCES video_versions(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_quotas (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	max_bytes BIGINT,
+	max_videos INTEGER,
+	max_duration_seconds DOUBLE PRECISION,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
@@ -0,0 +1,3 @@
+-- Postgres databases start out with the corrected column types, so there
+-- is nothing to fix. Kept so both dialects share version numbers.
+SELECT 1;
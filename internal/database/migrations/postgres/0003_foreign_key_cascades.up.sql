@@ -0,0 +1,42 @@
+-- Every row that belongs to a user or video goes when its owner does.
+
+ALTER TABLE refresh_tokens
+	DROP CONSTRAINT refresh_tokens_user_id_fkey,
+	ADD CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE user_watermarks
+	DROP CONSTRAINT user_watermarks_user_id_fkey,
+	ADD CONSTRAINT user_watermarks_user_id_fkey FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE user_quotas
+	DROP CONSTRAINT user_quotas_user_id_fkey,
+	ADD CONSTRAINT user_quotas_user_id_fkey FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE videos
+	DROP CONSTRAINT videos_user_id_fkey,
+	ADD CONSTRAINT videos_user_id_fkey FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE video_thumbnails
+	DROP CONSTRAINT video_thumbnails_video_id_fkey,
+	ADD CONSTRAINT video_thumbnails_video_id_fkey FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE;
+
+ALTER TABLE video_captions
+	DROP CONSTRAINT video_captions_video_id_fkey,
+	ADD CONSTRAINT video_captions_video_id_fkey FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE;
+
+ALTER TABLE video_storyboards
+	DROP CONSTRAINT video_storyboards_video_id_fkey,
+	ADD CONSTRAINT video_storyboards_video_id_fkey FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE;
+
+ALTER TABLE video_versions
+	DROP CONSTRAINT video_versions_video_id_fkey,
+	ADD CONSTRAINT video_versions_video_id_fkey FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE;
+
+ALTER TABLE video_version_storyboards
+	DROP CONSTRAINT video_version_storyboards_version_id_fkey,
+	ADD CONSTRAINT video_version_storyboards_version_id_fkey FOREIGN KEY(version_id) REFERENCES video_versions(id) ON DELETE CASCADE;
+
+-- Videos without an owner can't be reached, and go with their rows now
+-- that the cascades are in place
+DELETE FROM videos WHERE user_id IS NULL;
+ALTER TABLE videos ALTER COLUMN user_id SET NOT NULL;
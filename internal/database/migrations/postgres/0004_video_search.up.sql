@@ -0,0 +1,5 @@
+-- Full-text search over titles and descriptions. The 'simple'
+-- configuration doesn't stem, like SQLite's FTS5 default tokenizer.
+ALTER TABLE videos ADD COLUMN search_vector tsvector
+	GENERATED ALWAYS AS (to_tsvector('simple', title || ' ' || COALESCE(description, ''))) STORED;
+CREATE INDEX videos_search_vector_idx ON videos USING GIN (search_vector);
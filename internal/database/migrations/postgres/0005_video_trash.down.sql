@@ -0,0 +1,3 @@
+-- Videos still in the trash come back rather than losing their files
+DROP INDEX IF EXISTS videos_deleted_at_idx;
+ALTER TABLE videos DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+-- Deleted videos stay in the trash until the purge removes them for good
+ALTER TABLE videos ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX videos_deleted_at_idx ON videos (deleted_at);
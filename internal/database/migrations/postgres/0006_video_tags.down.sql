@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS video_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS video_tags;
+DROP TABLE IF EXISTS tags;
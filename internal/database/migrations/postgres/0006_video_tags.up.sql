@@ -0,0 +1,46 @@
+-- Tags are free-form and belong to the user who tagged with them.
+-- Categories are a fixed list every video can be filed under one of.
+
+CREATE TABLE tags (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	UNIQUE(user_id, name),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE video_tags (
+	video_id TEXT NOT NULL,
+	tag_id TEXT NOT NULL,
+	PRIMARY KEY(video_id, tag_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+CREATE INDEX video_tags_tag_id_idx ON video_tags (tag_id);
+
+CREATE TABLE categories (
+	slug TEXT PRIMARY KEY,
+	name TEXT NOT NULL
+);
+INSERT INTO categories (slug, name) VALUES
+	('comedy', 'Comedy'),
+	('education', 'Education'),
+	('entertainment', 'Entertainment'),
+	('film', 'Film & Animation'),
+	('gaming', 'Gaming'),
+	('howto', 'Howto & Style'),
+	('music', 'Music'),
+	('news', 'News & Politics'),
+	('people', 'People & Blogs'),
+	('pets', 'Pets & Animals'),
+	('science', 'Science & Technology'),
+	('sports', 'Sports'),
+	('travel', 'Travel & Events');
+
+CREATE TABLE video_categories (
+	video_id TEXT PRIMARY KEY,
+	category TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(category) REFERENCES categories(slug)
+);
+CREATE INDEX video_categories_category_idx ON video_categories (category);
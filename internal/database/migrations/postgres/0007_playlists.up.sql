@@ -0,0 +1,23 @@
+CREATE TABLE playlists (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	visibility TEXT NOT NULL DEFAULT 'private',
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX playlists_user_id_idx ON playlists (user_id);
+
+-- position orders a playlist's items from 0
+CREATE TABLE playlist_items (
+	playlist_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	added_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(playlist_id, video_id),
+	FOREIGN KEY(playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+CREATE INDEX playlist_items_video_id_idx ON playlist_items (video_id);
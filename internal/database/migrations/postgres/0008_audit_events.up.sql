@@ -0,0 +1,25 @@
+-- Security and content relevant actions. Actors and targets aren't
+-- foreign keys so the trail outlives what it is about.
+CREATE TABLE audit_events (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	action TEXT NOT NULL,
+	actor_id TEXT,
+	target_type TEXT NOT NULL DEFAULT '',
+	target_id TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	details TEXT
+);
+CREATE INDEX audit_events_action_idx ON audit_events (action);
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
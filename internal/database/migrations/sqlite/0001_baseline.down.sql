@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS user_quotas;
+DROP TABLE IF EXISTS video_version_storyboards;
+DROP TABLE IF EXISTS video_versions;
+DROP TABLE IF EXISTS video_storyboards;
+DROP TABLE IF EXISTS user_watermarks;
+DROP TABLE IF EXISTS video_captions;
+DROP TABLE IF EXISTS video_thumbnails;
+DROP TABLE IF EXISTS videos;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,132 @@
+-- The schema as autoMigrate left it, quirks included. Databases created
+-- before migrations existed are baselined at this version.
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	loudness_measured_lufs REAL,
+	loudness_measured_true_peak REAL,
+	loudness_target_lufs REAL,
+	original_video_url TEXT,
+	preview_url TEXT,
+	current_version_id TEXT,
+	audio_url TEXT,
+	audio_duration_seconds REAL,
+	stripped_metadata TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_thumbnails (
+	video_id TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	mime_type TEXT NOT NULL,
+	url TEXT NOT NULL,
+	PRIMARY KEY(video_id, width, mime_type),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_captions (
+	video_id TEXT NOT NULL,
+	language TEXT NOT NULL,
+	label TEXT NOT NULL,
+	caption_url TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, language),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_watermarks (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	image_path TEXT NOT NULL,
+	position TEXT NOT NULL,
+	opacity REAL NOT NULL,
+	scale REAL NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_storyboards (
+	video_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	storyboard_url TEXT NOT NULL,
+	sheet_count INTEGER NOT NULL,
+	frame_count INTEGER NOT NULL,
+	interval_seconds REAL NOT NULL,
+	duration_seconds REAL NOT NULL,
+	columns INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	tile_width INTEGER NOT NULL,
+	tile_height INTEGER NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_versions (
+	id TEXT PRIMARY KEY,
+	video_id TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	source TEXT NOT NULL,
+	video_url TEXT NOT NULL,
+	original_video_url TEXT,
+	preview_url TEXT,
+	loudness_measured_lufs REAL,
+	loudness_measured_true_peak REAL,
+	loudness_target_lufs REAL,
+	audio_url TEXT,
+	audio_duration_seconds REAL,
+	size_bytes INTEGER,
+	stripped_metadata TEXT,
+	UNIQUE(video_id, number),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_version_storyboards (
+	version_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	storyboard_url TEXT NOT NULL,
+	sheet_count INTEGER NOT NULL,
+	frame_count INTEGER NOT NULL,
+	interval_seconds REAL NOT NULL,
+	duration_seconds REAL NOT NULL,
+	columns INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	tile_width INTEGER NOT NULL,
+	tile_height INTEGER NOT NULL,
+	FOREIGN KEY(version_id) REFERENCES video_versions(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_quotas (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	max_bytes INTEGER,
+	max_videos INTEGER,
+	max_duration_seconds REAL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
@@ -0,0 +1,30 @@
+CREATE TABLE videos_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	loudness_measured_lufs REAL,
+	loudness_measured_true_peak REAL,
+	loudness_target_lufs REAL,
+	original_video_url TEXT,
+	preview_url TEXT,
+	current_version_id TEXT,
+	audio_url TEXT,
+	audio_duration_seconds REAL,
+	stripped_metadata TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_old SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id,
+	loudness_measured_lufs, loudness_measured_true_peak, loudness_target_lufs,
+	original_video_url, preview_url, current_version_id,
+	audio_url, audio_duration_seconds, stripped_metadata
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_old RENAME TO videos;
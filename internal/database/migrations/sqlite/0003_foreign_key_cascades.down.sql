@@ -0,0 +1,159 @@
+-- Back to plain foreign keys, which SQLite only enforces when asked to.
+
+CREATE TABLE refresh_tokens_new (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+INSERT INTO refresh_tokens_new (token, created_at, updated_at, revoked_at, user_id, expires_at)
+SELECT token, created_at, updated_at, revoked_at, user_id, expires_at FROM refresh_tokens;
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+
+CREATE TABLE user_watermarks_new (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	image_path TEXT NOT NULL,
+	position TEXT NOT NULL,
+	opacity REAL NOT NULL,
+	scale REAL NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+INSERT INTO user_watermarks_new (user_id, created_at, updated_at, image_path, position, opacity, scale)
+SELECT user_id, created_at, updated_at, image_path, position, opacity, scale FROM user_watermarks;
+DROP TABLE user_watermarks;
+ALTER TABLE user_watermarks_new RENAME TO user_watermarks;
+
+CREATE TABLE user_quotas_new (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	max_bytes INTEGER,
+	max_videos INTEGER,
+	max_duration_seconds REAL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+INSERT INTO user_quotas_new (user_id, created_at, updated_at, max_bytes, max_videos, max_duration_seconds)
+SELECT user_id, created_at, updated_at, max_bytes, max_videos, max_duration_seconds FROM user_quotas;
+DROP TABLE user_quotas;
+ALTER TABLE user_quotas_new RENAME TO user_quotas;
+
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT,
+	loudness_measured_lufs REAL,
+	loudness_measured_true_peak REAL,
+	loudness_target_lufs REAL,
+	original_video_url TEXT,
+	preview_url TEXT,
+	current_version_id TEXT,
+	audio_url TEXT,
+	audio_duration_seconds REAL,
+	stripped_metadata TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+INSERT INTO videos_new (id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id, loudness_measured_lufs, loudness_measured_true_peak, loudness_target_lufs, original_video_url, preview_url, current_version_id, audio_url, audio_duration_seconds, stripped_metadata)
+SELECT id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id, loudness_measured_lufs, loudness_measured_true_peak, loudness_target_lufs, original_video_url, preview_url, current_version_id, audio_url, audio_duration_seconds, stripped_metadata FROM videos;
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE TABLE video_thumbnails_new (
+	video_id TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	mime_type TEXT NOT NULL,
+	url TEXT NOT NULL,
+	PRIMARY KEY(video_id, width, mime_type),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+INSERT INTO video_thumbnails_new (video_id, width, mime_type, url)
+SELECT video_id, width, mime_type, url FROM video_thumbnails;
+DROP TABLE video_thumbnails;
+ALTER TABLE video_thumbnails_new RENAME TO video_thumbnails;
+
+CREATE TABLE video_captions_new (
+	video_id TEXT NOT NULL,
+	language TEXT NOT NULL,
+	label TEXT NOT NULL,
+	caption_url TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, language),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+INSERT INTO video_captions_new (video_id, language, label, caption_url, created_at, updated_at)
+SELECT video_id, language, label, caption_url, created_at, updated_at FROM video_captions;
+DROP TABLE video_captions;
+ALTER TABLE video_captions_new RENAME TO video_captions;
+
+CREATE TABLE video_storyboards_new (
+	video_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	storyboard_url TEXT NOT NULL,
+	sheet_count INTEGER NOT NULL,
+	frame_count INTEGER NOT NULL,
+	interval_seconds REAL NOT NULL,
+	duration_seconds REAL NOT NULL,
+	columns INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	tile_width INTEGER NOT NULL,
+	tile_height INTEGER NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+INSERT INTO video_storyboards_new (video_id, created_at, storyboard_url, sheet_count, frame_count, interval_seconds, duration_seconds, columns, rows, tile_width, tile_height)
+SELECT video_id, created_at, storyboard_url, sheet_count, frame_count, interval_seconds, duration_seconds, columns, rows, tile_width, tile_height FROM video_storyboards;
+DROP TABLE video_storyboards;
+ALTER TABLE video_storyboards_new RENAME TO video_storyboards;
+
+CREATE TABLE video_versions_new (
+	id TEXT PRIMARY KEY,
+	video_id TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	source TEXT NOT NULL,
+	video_url TEXT NOT NULL,
+	original_video_url TEXT,
+	preview_url TEXT,
+	loudness_measured_lufs REAL,
+	loudness_measured_true_peak REAL,
+	loudness_target_lufs REAL,
+	audio_url TEXT,
+	audio_duration_seconds REAL,
+	size_bytes INTEGER,
+	stripped_metadata TEXT,
+	UNIQUE(video_id, number),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+INSERT INTO video_versions_new (id, video_id, number, created_at, source, video_url, original_video_url, preview_url, loudness_measured_lufs, loudness_measured_true_peak, loudness_target_lufs, audio_url, audio_duration_seconds, size_bytes, stripped_metadata)
+SELECT id, video_id, number, created_at, source, video_url, original_video_url, preview_url, loudness_measured_lufs, loudness_measured_true_peak, loudness_target_lufs, audio_url, audio_duration_seconds, size_bytes, stripped_metadata FROM video_versions;
+DROP TABLE video_versions;
+ALTER TABLE video_versions_new RENAME TO video_versions;
+
+CREATE TABLE video_version_storyboards_new (
+	version_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	storyboard_url TEXT NOT NULL,
+	sheet_count INTEGER NOT NULL,
+	frame_count INTEGER NOT NULL,
+	interval_seconds REAL NOT NULL,
+	duration_seconds REAL NOT NULL,
+	columns INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	tile_width INTEGER NOT NULL,
+	tile_height INTEGER NOT NULL,
+	FOREIGN KEY(version_id) REFERENCES video_versions(id)
+);
+INSERT INTO video_version_storyboards_new (version_id, created_at, storyboard_url, sheet_count, frame_count, interval_seconds, duration_seconds, columns, rows, tile_width, tile_height)
+SELECT version_id, created_at, storyboard_url, sheet_count, frame_count, interval_seconds, duration_seconds, columns, rows, tile_width, tile_height FROM video_version_storyboards;
+DROP TABLE video_version_storyboards;
+ALTER TABLE video_version_storyboards_new RENAME TO video_version_storyboards;
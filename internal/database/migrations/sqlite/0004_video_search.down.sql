@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS video_search_insert;
+DROP TRIGGER IF EXISTS video_search_update;
+DROP TRIGGER IF EXISTS video_search_delete;
+DROP TABLE IF EXISTS video_search;
@@ -0,0 +1,4 @@
+-- The video_search FTS5 index only exists when the SQLite driver was built
+-- with FTS5, so Client.prepareSearch creates it at startup instead of
+-- this step. Rolling back past this version removes it.
+SELECT 1;
@@ -0,0 +1,24 @@
+-- Security and content relevant actions. Actors and targets aren't
+-- foreign keys so the trail outlives what it is about.
+CREATE TABLE audit_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	action TEXT NOT NULL,
+	actor_id TEXT,
+	target_type TEXT NOT NULL DEFAULT '',
+	target_id TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	details TEXT
+);
+CREATE INDEX audit_events_action_idx ON audit_events (action);
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events BEGIN
+	SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events BEGIN
+	SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
@@ -0,0 +1,4 @@
+-- Counts the writes to a video. It is the video's ETag and what a
+-- conditional update compares, since updated_at only has second
+-- precision on SQLite.
+ALTER TABLE videos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,367 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrVideoInPlaylist is returned when adding a video a playlist already has
+var ErrVideoInPlaylist = errors.New("video is already in the playlist")
+
+// ErrPlaylistOrder is returned by ReorderPlaylist for a list that isn't
+// exactly the playlist's videos
+var ErrPlaylistOrder = errors.New("the new order must list every video of the playlist once")
+
+// Playlist visibilities. Private playlists are only seen by their owner,
+// unlisted and public ones by anyone who has the link. Public ones are
+// also listed by GetPublicPlaylists.
+const (
+	PlaylistPrivate  = "private"
+	PlaylistUnlisted = "unlisted"
+	PlaylistPublic   = "public"
+)
+
+// Playlist is an ordered list of its owner's videos. VideoCount leaves out
+// videos in the trash, which stay in the playlist but aren't shown.
+type Playlist struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	VideoCount int       `json:"video_count"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	// Visibility is PlaylistPrivate, PlaylistUnlisted or PlaylistPublic
+	Visibility string `json:"visibility"`
+}
+
+func ValidPlaylistVisibility(visibility string) bool {
+	switch visibility {
+	case PlaylistPrivate, PlaylistUnlisted, PlaylistPublic:
+		return true
+	}
+	return false
+}
+
+const playlistColumns = `
+		p.id,
+		p.created_at,
+		p.updated_at,
+		p.user_id,
+		p.title,
+		p.description,
+		p.visibility,
+		(SELECT COUNT(*) FROM playlist_items i JOIN videos v ON v.id = i.video_id
+			WHERE i.playlist_id = p.id AND v.deleted_at IS NULL)
+`
+
+func scanPlaylist(row rowScanner) (Playlist, error) {
+	var playlist Playlist
+	err := row.Scan(
+		&playlist.ID,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.UserID,
+		&playlist.Title,
+		&playlist.Description,
+		&playlist.Visibility,
+		&playlist.VideoCount,
+	)
+	return playlist, err
+}
+
+func (c Client) CreatePlaylist(params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO playlists (
+		id,
+		created_at,
+		updated_at,
+		user_id,
+		title,
+		description,
+		visibility
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.UserID, params.Title, params.Description, params.Visibility)
+	if err != nil {
+		return Playlist{}, err
+	}
+	return c.GetPlaylist(id)
+}
+
+// GetPlaylist returns a zero Playlist if there is no such playlist.
+func (c Client) GetPlaylist(id uuid.UUID) (Playlist, error) {
+	query := `
+	SELECT` + playlistColumns + `
+	FROM playlists p
+	WHERE p.id = ?
+	`
+	playlist, err := scanPlaylist(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Playlist{}, nil
+	}
+	if err != nil {
+		return Playlist{}, err
+	}
+	return playlist, nil
+}
+
+// GetPlaylists returns the user's playlists, most recently updated first.
+func (c Client) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	query := `
+	SELECT` + playlistColumns + `
+	FROM playlists p
+	WHERE p.user_id = ?
+	ORDER BY p.updated_at DESC, p.id
+	`
+	return c.queryPlaylists(query, userID)
+}
+
+// GetPublicPlaylists returns the user's public playlists, most recently
+// updated first, for anyone to browse.
+func (c Client) GetPublicPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	query := `
+	SELECT` + playlistColumns + `
+	FROM playlists p
+	WHERE p.user_id = ? AND p.visibility = ?
+	ORDER BY p.updated_at DESC, p.id
+	`
+	return c.queryPlaylists(query, userID, PlaylistPublic)
+}
+
+func (c Client) queryPlaylists(query string, args ...any) ([]Playlist, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		playlist, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, rows.Err()
+}
+
+// UpdatePlaylist stores the title, description and visibility.
+func (c Client) UpdatePlaylist(playlist Playlist) error {
+	query := `
+	UPDATE playlists
+	SET
+		title = ?,
+		description = ?,
+		visibility = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, playlist.Title, playlist.Description, playlist.Visibility, playlist.ID)
+	return err
+}
+
+// DeletePlaylist deletes the playlist, not the videos in it.
+func (c Client) DeletePlaylist(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM playlists WHERE id = ?`, id)
+	return err
+}
+
+// GetPlaylistVideos returns the playlist's videos in order, leaving out
+// the ones in the trash.
+func (c Client) GetPlaylistVideos(playlistID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + qualifiedVideoColumns("v") + `
+	FROM playlist_items i
+	JOIN videos v ON v.id = i.video_id
+	WHERE i.playlist_id = ? AND v.deleted_at IS NULL
+	ORDER BY i.position
+	`
+	return c.queryVideos(query, playlistID)
+}
+
+// AddPlaylistVideo inserts the video at position, counted from 0 in the
+// list GetPlaylistVideos returns, moving the videos from there on down. A
+// position past the end appends it, after any videos in the trash.
+func (c Client) AddPlaylistVideo(playlistID, videoID uuid.UUID, position int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT i.video_id, i.position, v.deleted_at IS NOT NULL
+	FROM playlist_items i
+	JOIN videos v ON v.id = i.video_id
+	WHERE i.playlist_id = ?
+	ORDER BY i.position
+	`
+	rows, err := tx.Query(query, playlistID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Trashed videos aren't shown, so they don't count towards position
+	position = max(0, position)
+	at, shown, next := -1, 0, 0
+	for rows.Next() {
+		var itemID uuid.UUID
+		var itemPosition int
+		var inTrash bool
+		if err := rows.Scan(&itemID, &itemPosition, &inTrash); err != nil {
+			return err
+		}
+		if itemID == videoID {
+			return ErrVideoInPlaylist
+		}
+		next = itemPosition + 1
+		if inTrash {
+			continue
+		}
+		if shown == position && at < 0 {
+			at = itemPosition
+		}
+		shown++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if at < 0 {
+		at = next
+	}
+
+	_, err = tx.Exec(`UPDATE playlist_items SET position = position + 1 WHERE playlist_id = ? AND position >= ?`, playlistID, at)
+	if err != nil {
+		return err
+	}
+	query = `
+	INSERT INTO playlist_items (playlist_id, video_id, position, added_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err = tx.Exec(query, playlistID, videoID, at)
+	if err != nil {
+		return err
+	}
+	err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemovePlaylistVideo takes the video out of the playlist. It is a no-op
+// if the video isn't in it.
+func (c Client) RemovePlaylistVideo(playlistID, videoID uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow(`SELECT position FROM playlist_items WHERE playlist_id = ? AND video_id = ?`, playlistID, videoID).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM playlist_items WHERE playlist_id = ? AND video_id = ?`, playlistID, videoID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE playlist_items SET position = position - 1 WHERE playlist_id = ? AND position > ?`, playlistID, position)
+	if err != nil {
+		return err
+	}
+	err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderPlaylist puts the playlist's videos in the given order. It has to
+// list every video GetPlaylistVideos returns; videos in the trash keep
+// their relative order after them.
+func (c Client) ReorderPlaylist(playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT i.video_id, v.deleted_at IS NOT NULL
+	FROM playlist_items i
+	JOIN videos v ON v.id = i.video_id
+	WHERE i.playlist_id = ?
+	ORDER BY i.position
+	`
+	rows, err := tx.Query(query, playlistID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	shown := map[uuid.UUID]bool{}
+	trashed := []uuid.UUID{}
+	for rows.Next() {
+		var videoID uuid.UUID
+		var inTrash bool
+		if err := rows.Scan(&videoID, &inTrash); err != nil {
+			return err
+		}
+		if inTrash {
+			trashed = append(trashed, videoID)
+		} else {
+			shown[videoID] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if len(videoIDs) != len(shown) {
+		return ErrPlaylistOrder
+	}
+	for _, videoID := range videoIDs {
+		if !shown[videoID] {
+			return ErrPlaylistOrder
+		}
+		// A duplicate would match twice
+		delete(shown, videoID)
+	}
+
+	order := append(append([]uuid.UUID{}, videoIDs...), trashed...)
+	for position, videoID := range order {
+		_, err = tx.Exec(`UPDATE playlist_items SET position = ? WHERE playlist_id = ? AND video_id = ?`, position, playlistID, videoID)
+		if err != nil {
+			return err
+		}
+	}
+	err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func touchPlaylist(q querier, playlistID uuid.UUID) error {
+	_, err := q.Exec(`UPDATE playlists SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, playlistID)
+	return err
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrQuotaExceeded is returned when a write would take the user past the
+// QuotaLimits it was given
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaLimits are checked against the user's usage in the same
+// transaction that adds to it, so concurrent uploads can't all fit in
+// the room that is left for one. 0 means unlimited.
+type QuotaLimits struct {
+	MaxBytes  int64
+	MaxVideos int
+}
+
+// UserQuota overrides the deployment's default limits for one user.
+// Nil fields keep the default, 0 means unlimited.
+type UserQuota struct {
+	UserID             uuid.UUID `json:"user_id"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	MaxBytes           *int64    `json:"max_bytes"`
+	MaxVideos          *int      `json:"max_videos"`
+	MaxDurationSeconds *float64  `json:"max_duration_seconds"`
+}
+
+// Usage is what a user's videos take up. Bytes counts the stored files of
+// every version, not just the current ones.
+type Usage struct {
+	Bytes  int64 `json:"bytes"`
+	Videos int   `json:"videos"`
+}
+
+// GetUserQuota returns nil if the user has no overrides.
+func (c Client) GetUserQuota(userID uuid.UUID) (*UserQuota, error) {
+	query := `
+	SELECT user_id, created_at, updated_at, max_bytes, max_videos, max_duration_seconds
+	FROM user_quotas
+	WHERE user_id = ?
+	`
+
+	var quota UserQuota
+	err := c.db.QueryRow(query, userID).Scan(
+		&quota.UserID,
+		&quota.CreatedAt,
+		&quota.UpdatedAt,
+		&quota.MaxBytes,
+		&quota.MaxVideos,
+		&quota.MaxDurationSeconds,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &quota, nil
+}
+
+func (c Client) UpsertUserQuota(quota UserQuota) (*UserQuota, error) {
+	query := `
+	INSERT INTO user_quotas (
+		user_id,
+		created_at,
+		updated_at,
+		max_bytes,
+		max_videos,
+		max_duration_seconds
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		max_bytes = excluded.max_bytes,
+		max_videos = excluded.max_videos,
+		max_duration_seconds = excluded.max_duration_seconds
+	`
+	_, err := c.db.Exec(
+		query,
+		quota.UserID,
+		quota.MaxBytes,
+		quota.MaxVideos,
+		quota.MaxDurationSeconds,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetUserQuota(quota.UserID)
+}
+
+func (c Client) DeleteUserQuota(userID uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM user_quotas WHERE user_id = ?`, userID)
+	return err
+}
+
+// GetUsage counts videos in the trash too, their files are still stored
+// until they are purged.
+func (c Client) GetUsage(userID uuid.UUID) (Usage, error) {
+	return getUsage(c.db, userID)
+}
+
+func getUsage(q querier, userID uuid.UUID) (Usage, error) {
+	var usage Usage
+	err := q.QueryRow(`SELECT COUNT(*) FROM videos WHERE user_id = ?`, userID).Scan(&usage.Videos)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	query := `
+	SELECT COALESCE(SUM(v.size_bytes), 0)
+	FROM video_versions v
+	JOIN videos ON videos.id = v.video_id
+	WHERE videos.user_id = ?
+	`
+	err = q.QueryRow(query, userID).Scan(&usage.Bytes)
+	if err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+// lockUser takes the user's lock until the transaction q is part of ends,
+// so their usage can't change in between checkQuota and the insert it
+// allows. A write that changes nothing takes the row lock on Postgres and
+// the database's write lock on SQLite. It has to be the transaction's
+// first statement: on SQLite, a transaction that read before it writes
+// can deadlock with another one doing the same.
+func lockUser(q querier, userID uuid.UUID) error {
+	_, err := q.Exec(`UPDATE users SET updated_at = updated_at WHERE id = ?`, userID)
+	return err
+}
+
+// lockVideoOwner is lockUser for the owner of the video.
+func lockVideoOwner(q querier, videoID uuid.UUID) error {
+	_, err := q.Exec(`UPDATE users SET updated_at = updated_at WHERE id = (SELECT user_id FROM videos WHERE id = ?)`, videoID)
+	return err
+}
+
+// checkQuota returns ErrQuotaExceeded if adding bytes and videos to the
+// user's usage goes past the limits. The user has to be locked.
+func checkQuota(q querier, userID uuid.UUID, limits QuotaLimits, bytes int64, videos int) error {
+	usage, err := getUsage(q, userID)
+	if err != nil {
+		return err
+	}
+	if limits.MaxBytes > 0 && usage.Bytes+bytes > limits.MaxBytes {
+		return ErrQuotaExceeded
+	}
+	if limits.MaxVideos > 0 && videos > 0 && usage.Videos+videos > limits.MaxVideos {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
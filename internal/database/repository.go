@@ -0,0 +1,120 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserRepository stores accounts. Lookups of a user that doesn't exist
+// return nil (or a zero User from GetUserByEmail) and no error.
+type UserRepository interface {
+	GetUsers() ([]User, error)
+	GetUser(id uuid.UUID) (*User, error)
+	GetUserByEmail(email string) (User, error)
+	GetUserByRefreshToken(token string) (*User, error)
+	CreateUser(params CreateUserParams) (*User, error)
+	DeleteUser(id uuid.UUID) error
+}
+
+// VideoRepository stores video metadata. GetVideo returns a zero Video
+// and no error when there is no such video. Videos in the trash are left
+// out of every list and search except GetTrashedVideos.
+type VideoRepository interface {
+	GetVideos(userID uuid.UUID) ([]Video, error)
+	GetVideoPage(userID uuid.UUID, opts VideoListOptions) (VideoPage, error)
+	SearchVideos(userID uuid.UUID, terms []string, limit int, cursor string) (VideoSearchPage, error)
+	GetVideo(id uuid.UUID) (Video, error)
+	CreateVideo(params CreateVideoParams) (Video, error)
+	CreateVideoWithVersion(id uuid.UUID, params CreateVideoParams, version CreateVideoVersionParams, limits QuotaLimits) (Video, error)
+	UpdateVideo(video Video) error
+	UpdateVideoDetails(id uuid.UUID, details VideoDetails, ifVersion *int) error
+	DeleteVideo(id uuid.UUID) error
+	TrashVideo(id uuid.UUID) error
+	RestoreVideo(id uuid.UUID) error
+	GetTrashedVideos(userID uuid.UUID) ([]Video, error)
+	GetVideosTrashedBefore(cutoff time.Time) ([]Video, error)
+	PurgeVideo(id uuid.UUID, cutoff time.Time) (bool, error)
+	GetCategories() ([]Category, error)
+	GetUserTags(userID uuid.UUID) ([]TagCount, error)
+	SetVideoTags(videoID uuid.UUID, tags []string) error
+	SetVideoCategory(videoID uuid.UUID, category *string) error
+	ReplaceVideoThumbnails(videoID uuid.UUID, thumbnails []Thumbnail) error
+	GetCaption(videoID uuid.UUID, language string) (*Caption, error)
+	UpsertCaption(caption Caption) (*Caption, error)
+	DeleteCaption(videoID uuid.UUID, language string) error
+}
+
+// VideoVersionRepository stores the uploads of a video. GetVideoVersion
+// returns a zero VideoVersion and no error when there is no such version.
+type VideoVersionRepository interface {
+	CreateVideoVersion(params CreateVideoVersionParams, limits QuotaLimits) (VideoVersion, error)
+	GetVideoVersion(videoID uuid.UUID, number int) (VideoVersion, error)
+	GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error)
+	GetUnsizedVideoVersions() ([]VideoVersion, error)
+	SetVideoVersionSize(id uuid.UUID, sizeBytes int64) error
+	SetCurrentVersion(version VideoVersion) error
+	DeleteVideoVersion(id uuid.UUID) error
+}
+
+// UserSettingsRepository stores per-user quotas and watermarks, and the
+// usage quotas are checked against. GetUserQuota and GetWatermark return
+// nil and no error when the user has none.
+type UserSettingsRepository interface {
+	GetUsage(userID uuid.UUID) (Usage, error)
+	GetUserQuota(userID uuid.UUID) (*UserQuota, error)
+	UpsertUserQuota(quota UserQuota) (*UserQuota, error)
+	DeleteUserQuota(userID uuid.UUID) error
+	GetWatermark(userID uuid.UUID) (*Watermark, error)
+	UpsertWatermark(watermark Watermark) (*Watermark, error)
+	DeleteWatermark(userID uuid.UUID) error
+}
+
+// RefreshTokenRepository stores refresh tokens. GetRefreshToken returns
+// a zero RefreshToken and no error for an unknown token.
+type RefreshTokenRepository interface {
+	CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error)
+	GetRefreshToken(token string) (RefreshToken, error)
+	RevokeRefreshToken(token string) error
+	DeleteRefreshToken(token string) error
+}
+
+// PlaylistRepository stores playlists and their order. GetPlaylist
+// returns a zero Playlist and no error when there is no such playlist.
+type PlaylistRepository interface {
+	CreatePlaylist(params CreatePlaylistParams) (Playlist, error)
+	GetPlaylist(id uuid.UUID) (Playlist, error)
+	GetPlaylists(userID uuid.UUID) ([]Playlist, error)
+	GetPublicPlaylists(userID uuid.UUID) ([]Playlist, error)
+	UpdatePlaylist(playlist Playlist) error
+	DeletePlaylist(id uuid.UUID) error
+	GetPlaylistVideos(playlistID uuid.UUID) ([]Video, error)
+	AddPlaylistVideo(playlistID, videoID uuid.UUID, position int) error
+	RemovePlaylistVideo(playlistID, videoID uuid.UUID) error
+	ReorderPlaylist(playlistID uuid.UUID, videoIDs []uuid.UUID) error
+}
+
+// AuditRepository appends to the audit log and reads it back. There is
+// no way to change or remove an event.
+type AuditRepository interface {
+	CreateAuditEvent(event AuditEvent) error
+	GetAuditEvents(filter AuditEventFilter) ([]AuditEvent, error)
+	EachAuditEvent(filter AuditEventFilter, fn func(AuditEvent) error) error
+}
+
+// Repository is the part of the database every backend has to provide the
+// same way. Client implements it on SQLite and on Postgres, picked by
+// NewClient from the DB_URL; the databasetest package checks both agree.
+type Repository interface {
+	UserRepository
+	VideoRepository
+	VideoVersionRepository
+	UserSettingsRepository
+	PlaylistRepository
+	RefreshTokenRepository
+	AuditRepository
+	Reset() error
+	Close() error
+}
+
+var _ Repository = Client{}
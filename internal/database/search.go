@@ -0,0 +1,326 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// searchIndex is how SearchVideos finds matches on this database
+type searchIndex int
+
+const (
+	// searchLike scans titles and descriptions with LIKE. SQLite falls
+	// back to it when the driver was built without FTS5.
+	searchLike searchIndex = iota
+	// searchFTS5 uses the video_search FTS5 table, see prepareSearch
+	searchFTS5
+	// searchTSVector uses the videos.search_vector column on Postgres
+	searchTSVector
+)
+
+// RankedSearch reports whether SearchVideos uses a full-text index. It
+// doesn't on SQLite built without FTS5, where it falls back to a slower,
+// unranked substring match.
+func (c Client) RankedSearch() bool {
+	return c.search != searchLike
+}
+
+// Most words of a query that are searched for, the rest are ignored
+const maxSearchTerms = 10
+
+// Words around the first match a description snippet keeps
+const snippetWords = 12
+
+// VideoSearchResult is a matching video with its title and a snippet of
+// its description. Both are HTML escaped with the matched words wrapped
+// in <mark>.
+type VideoSearchResult struct {
+	Video
+	TitleHighlight string `json:"title_highlight"`
+	Snippet        string `json:"snippet"`
+}
+
+// VideoSearchPage is one page of search results, best match first
+type VideoSearchPage struct {
+	Results    []VideoSearchResult `json:"results"`
+	NextCursor *string             `json:"next_cursor"`
+	Total      int                 `json:"total"`
+}
+
+// SearchTerms splits a query into the lowercased words SearchVideos looks
+// for. Punctuation and search syntax are dropped.
+func SearchTerms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// prepareSearch picks the search index for the database. On SQLite built
+// with FTS5 (go build -tags sqlite_fts5) it makes sure the video_search
+// table and the triggers that keep it in sync with videos exist; a table
+// rebuild by a migration drops the triggers, so they are checked on every
+// start and the index is rebuilt when any are missing.
+func (c Client) prepareSearch() (searchIndex, error) {
+	if _, ok := c.db.dialect.(postgresDialect); ok {
+		return searchTSVector, nil
+	}
+
+	var fts5 bool
+	err := c.db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5)
+	if err != nil {
+		return searchLike, err
+	}
+	if !fts5 {
+		return searchLike, nil
+	}
+
+	var triggers int
+	err = c.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'video_search_%'`).Scan(&triggers)
+	if err != nil {
+		return searchLike, err
+	}
+	if triggers == 3 {
+		return searchFTS5, nil
+	}
+
+	_, err = c.db.Exec(`
+	DROP TABLE IF EXISTS video_search;
+	CREATE VIRTUAL TABLE video_search USING fts5(
+		video_id UNINDEXED,
+		title,
+		description
+	);
+	INSERT INTO video_search (video_id, title, description)
+	SELECT id, title, COALESCE(description, '') FROM videos;
+
+	CREATE TRIGGER IF NOT EXISTS video_search_insert AFTER INSERT ON videos BEGIN
+		INSERT INTO video_search (video_id, title, description)
+		VALUES (new.id, new.title, COALESCE(new.description, ''));
+	END;
+	CREATE TRIGGER IF NOT EXISTS video_search_update AFTER UPDATE OF title, description ON videos BEGIN
+		UPDATE video_search
+		SET title = new.title, description = COALESCE(new.description, '')
+		WHERE video_id = old.id;
+	END;
+	CREATE TRIGGER IF NOT EXISTS video_search_delete AFTER DELETE ON videos BEGIN
+		DELETE FROM video_search WHERE video_id = old.id;
+	END;
+	`)
+	if err != nil {
+		return searchLike, err
+	}
+	return searchFTS5, nil
+}
+
+// SearchVideos finds the user's videos whose title or description has
+// every term, the last one as a prefix so results show up while typing.
+// Without a full-text index terms match anywhere in a word.
+func (c Client) SearchVideos(userID uuid.UUID, terms []string, limit int, cursor string) (VideoSearchPage, error) {
+	if len(terms) == 0 {
+		return VideoSearchPage{Results: []VideoSearchResult{}}, nil
+	}
+	if limit <= 0 {
+		limit = DefaultVideoPageSize
+	}
+	offset := 0
+	if cursor != "" {
+		var err error
+		offset, err = decodeOffsetCursor(cursor)
+		if err != nil {
+			return VideoSearchPage{}, ErrInvalidCursor
+		}
+	}
+
+	q := c.searchQuery(userID, terms)
+
+	var page VideoSearchPage
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM `+q.from+` WHERE `+q.where, q.whereArgs...).Scan(&page.Total)
+	if err != nil {
+		return VideoSearchPage{}, err
+	}
+
+	query := `
+	SELECT` + qualifiedVideoColumns("v") + `
+	FROM ` + q.from + `
+	WHERE ` + q.where + `
+	ORDER BY ` + q.order + `
+	LIMIT ? OFFSET ?
+	`
+	args := append(append(q.whereArgs, q.orderArgs...), limit+1, offset)
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return VideoSearchPage{}, err
+	}
+	defer rows.Close()
+
+	page.Results = []VideoSearchResult{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return VideoSearchPage{}, err
+		}
+		page.Results = append(page.Results, VideoSearchResult{
+			Video:          video,
+			TitleHighlight: highlight(video.Title, terms, 0),
+			Snippet:        highlight(video.Description, terms, snippetWords),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return VideoSearchPage{}, err
+	}
+	rows.Close()
+
+	if len(page.Results) > limit {
+		page.Results = page.Results[:limit]
+		next := encodeOffsetCursor(offset + limit)
+		page.NextCursor = &next
+	}
+
+	for i := range page.Results {
+		if err := c.attachMedia(&page.Results[i].Video); err != nil {
+			return VideoSearchPage{}, err
+		}
+	}
+	return page, nil
+}
+
+// searchClauses are the FROM, WHERE and ORDER BY clauses of a search,
+// with videos aliased as v
+type searchClauses struct {
+	from      string
+	where     string
+	whereArgs []any
+	order     string
+	orderArgs []any
+}
+
+func (c Client) searchQuery(userID uuid.UUID, terms []string) searchClauses {
+	switch c.search {
+	case searchFTS5:
+		// Every term is quoted so it can't be read as FTS5 syntax
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + term + `"`
+		}
+		match := strings.Join(quoted, " ") + "*"
+		return searchClauses{
+			from:      "video_search JOIN videos v ON v.id = video_search.video_id",
+			where:     "video_search MATCH ? AND v.user_id = ? AND v.deleted_at IS NULL",
+			whereArgs: []any{match, userID},
+			// Title matches count ten times as much as description ones
+			order: "bm25(video_search, 0, 10.0, 1.0), v.created_at DESC, v.id",
+		}
+
+	case searchTSVector:
+		match := strings.Join(terms, " & ") + ":*"
+		return searchClauses{
+			from:      "videos v",
+			where:     "v.search_vector @@ to_tsquery('simple', ?) AND v.user_id = ? AND v.deleted_at IS NULL",
+			whereArgs: []any{match, userID},
+			order:     "ts_rank(v.search_vector, to_tsquery('simple', ?)) DESC, v.created_at DESC, v.id",
+			orderArgs: []any{match},
+		}
+	}
+
+	q := searchClauses{from: "videos v"}
+	where := []string{"v.user_id = ?", "v.deleted_at IS NULL"}
+	q.whereArgs = []any{userID}
+	titleMatch := make([]string, len(terms))
+	for i, term := range terms {
+		where = append(where, "(v.title LIKE ? OR v.description LIKE ?)")
+		q.whereArgs = append(q.whereArgs, "%"+term+"%", "%"+term+"%")
+		titleMatch[i] = "v.title LIKE ?"
+		q.orderArgs = append(q.orderArgs, "%"+term+"%")
+	}
+	q.where = strings.Join(where, " AND ")
+	// Videos with every term in the title first
+	q.order = "CASE WHEN " + strings.Join(titleMatch, " AND ") + " THEN 0 ELSE 1 END, v.created_at DESC, v.id"
+	return q
+}
+
+func qualifiedVideoColumns(alias string) string {
+	columns := strings.Split(videoColumns, ",")
+	for i, column := range columns {
+		columns[i] = "\n\t\t" + alias + "." + strings.TrimSpace(column)
+	}
+	return strings.Join(columns, ",") + "\n"
+}
+
+// highlight HTML escapes text and marks the words that start with one of
+// the terms. With maxWords > 0 it keeps that many words around the first
+// match, or from the start if nothing matched.
+func highlight(text string, terms []string, maxWords int) string {
+	words := strings.Fields(text)
+	matches := make([]bool, len(words))
+	first := -1
+	for i, word := range words {
+		lower := strings.ToLower(strings.TrimLeftFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) {
+				matches[i] = true
+				if first < 0 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+
+	start, end := 0, len(words)
+	if maxWords > 0 && len(words) > maxWords {
+		start = max(0, first-maxWords/3)
+		end = min(len(words), start+maxWords)
+		start = max(0, end-maxWords)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("… ")
+	}
+	for i := start; i < end; i++ {
+		if i > start {
+			b.WriteByte(' ')
+		}
+		if matches[i] {
+			b.WriteString("<mark>" + html.EscapeString(words[i]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(words[i]))
+		}
+	}
+	if end < len(words) {
+		b.WriteString(" …")
+	}
+	return b.String()
+}
+
+func encodeOffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeOffsetCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := strings.CutPrefix(string(data), "offset:")
+	if !ok {
+		return 0, errors.New("not an offset cursor")
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid offset")
+	}
+	return offset, nil
+}
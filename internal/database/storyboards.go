@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// Storyboard describes the seek-bar sprite sheets of a video: FrameCount
+// frames taken every IntervalSeconds, tiled Columns x Rows per sheet.
+// StoryboardURL is the "bucket,prefix" the sheets and the WebVTT index
+// are stored under. VTTURL and SpriteURLs are only filled in for clients.
+type Storyboard struct {
+	StoryboardURL   string   `json:"-"`
+	SheetCount      int      `json:"sheet_count"`
+	FrameCount      int      `json:"frame_count"`
+	IntervalSeconds float64  `json:"interval_seconds"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	Columns         int      `json:"columns"`
+	Rows            int      `json:"rows"`
+	TileWidth       int      `json:"tile_width"`
+	TileHeight      int      `json:"tile_height"`
+	VTTURL          string   `json:"vtt_url,omitempty"`
+	SpriteURLs      []string `json:"sprite_urls,omitempty"`
+}
+
+// GetStoryboard returns nil if the video has no storyboard.
+func (c Client) GetStoryboard(videoID uuid.UUID) (*Storyboard, error) {
+	return getStoryboard(c.db, "video_storyboards", "video_id", videoID)
+}
+
+// SetStoryboard stores the video's storyboard, replacing any previous one.
+// A nil storyboard removes it.
+func (c Client) SetStoryboard(videoID uuid.UUID, storyboard *Storyboard) error {
+	return setStoryboard(c.db, "video_storyboards", "video_id", videoID, storyboard)
+}
+
+// Videos and their versions keep storyboards in tables of the same shape,
+// keyed by keyColumn.
+func getStoryboard(q querier, table, keyColumn string, id uuid.UUID) (*Storyboard, error) {
+	query := `
+	SELECT
+		storyboard_url,
+		sheet_count,
+		frame_count,
+		interval_seconds,
+		duration_seconds,
+		columns,
+		rows,
+		tile_width,
+		tile_height
+	FROM ` + table + `
+	WHERE ` + keyColumn + ` = ?
+	`
+
+	var storyboard Storyboard
+	err := q.QueryRow(query, id).Scan(
+		&storyboard.StoryboardURL,
+		&storyboard.SheetCount,
+		&storyboard.FrameCount,
+		&storyboard.IntervalSeconds,
+		&storyboard.DurationSeconds,
+		&storyboard.Columns,
+		&storyboard.Rows,
+		&storyboard.TileWidth,
+		&storyboard.TileHeight,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &storyboard, nil
+}
+
+func setStoryboard(q querier, table, keyColumn string, id uuid.UUID, storyboard *Storyboard) error {
+	_, err := q.Exec(`DELETE FROM `+table+` WHERE `+keyColumn+` = ?`, id)
+	if err != nil || storyboard == nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO ` + table + ` (
+		` + keyColumn + `,
+		created_at,
+		storyboard_url,
+		sheet_count,
+		frame_count,
+		interval_seconds,
+		duration_seconds,
+		columns,
+		rows,
+		tile_width,
+		tile_height
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = q.Exec(
+		query,
+		id,
+		storyboard.StoryboardURL,
+		storyboard.SheetCount,
+		storyboard.FrameCount,
+		storyboard.IntervalSeconds,
+		storyboard.DurationSeconds,
+		storyboard.Columns,
+		storyboard.Rows,
+		storyboard.TileWidth,
+		storyboard.TileHeight,
+	)
+	return err
+}
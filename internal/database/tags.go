@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidTags is returned for a tag list NormalizeTags rejects
+var ErrInvalidTags = errors.New("invalid tags")
+
+// ErrUnknownCategory is returned for a category GetCategories doesn't list
+var ErrUnknownCategory = errors.New("unknown category")
+
+const (
+	maxTagsPerVideo = 20
+	maxTagLength    = 40
+)
+
+// Category is one entry of the fixed category list
+type Category struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// TagCount is one of a user's tags and how many of their videos have it,
+// not counting the ones in the trash
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags lowercases the tags and collapses their whitespace,
+// dropping empty ones and duplicates. A video has at most 20 tags of at
+// most 40 characters.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidTags, tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTagsPerVideo {
+		return nil, fmt.Errorf("%w: a video can have at most %d tags", ErrInvalidTags, maxTagsPerVideo)
+	}
+	return normalized, nil
+}
+
+// GetCategories returns the category list, by name.
+func (c Client) GetCategories() ([]Category, error) {
+	rows, err := c.db.Query(`SELECT slug, name FROM categories ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.Slug, &category.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// GetVideoTags returns the video's tags in alphabetical order.
+func (c Client) GetVideoTags(videoID uuid.UUID) ([]string, error) {
+	query := `
+	SELECT t.name
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id = ?
+	ORDER BY t.name
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// GetVideoCategory returns nil if the video isn't in a category.
+func (c Client) GetVideoCategory(videoID uuid.UUID) (*string, error) {
+	var category string
+	err := c.db.QueryRow(`SELECT category FROM video_categories WHERE video_id = ?`, videoID).Scan(&category)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetUserTags returns every tag on the user's videos with how many videos
+// have it, most used first.
+func (c Client) GetUserTags(userID uuid.UUID) ([]TagCount, error) {
+	query := `
+	SELECT t.name, COUNT(*)
+	FROM tags t
+	JOIN video_tags vt ON vt.tag_id = t.id
+	JOIN videos v ON v.id = vt.video_id
+	WHERE t.user_id = ? AND v.deleted_at IS NULL
+	GROUP BY t.name
+	ORDER BY COUNT(*) DESC, t.name
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// SetVideoTags replaces the video's tags, see NormalizeTags.
+func (c Client) SetVideoTags(videoID uuid.UUID, tags []string) error {
+	return c.UpdateVideoDetails(videoID, VideoDetails{Tags: &tags}, nil)
+}
+
+// SetVideoCategory files the video under the category, or under none if
+// it is nil.
+func (c Client) SetVideoCategory(videoID uuid.UUID, category *string) error {
+	return c.UpdateVideoDetails(videoID, VideoDetails{Category: category, SetCategory: true}, nil)
+}
+
+func setVideoTags(q querier, videoID, userID uuid.UUID, tags []string) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`DELETE FROM video_tags WHERE video_id = ?`, videoID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err = q.Exec(`
+		INSERT INTO tags (id, user_id, name) VALUES (?, ?, ?)
+		ON CONFLICT(user_id, name) DO NOTHING
+		`, uuid.New(), userID, tag)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec(`
+		INSERT INTO video_tags (video_id, tag_id)
+		SELECT ?, id FROM tags WHERE user_id = ? AND name = ?
+		`, videoID, userID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Tags no video uses anymore
+	_, err = q.Exec(`
+	DELETE FROM tags
+	WHERE user_id = ? AND NOT EXISTS (SELECT 1 FROM video_tags vt WHERE vt.tag_id = tags.id)
+	`, userID)
+	return err
+}
+
+func setVideoCategory(q querier, videoID uuid.UUID, category *string) error {
+	if category == nil {
+		_, err := q.Exec(`DELETE FROM video_categories WHERE video_id = ?`, videoID)
+		return err
+	}
+
+	var known int
+	err := q.QueryRow(`SELECT COUNT(*) FROM categories WHERE slug = ?`, *category).Scan(&known)
+	if err != nil {
+		return err
+	}
+	if known == 0 {
+		return fmt.Errorf("%w %q", ErrUnknownCategory, *category)
+	}
+
+	query := `
+	INSERT INTO video_categories (video_id, category) VALUES (?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET category = excluded.category
+	`
+	_, err = q.Exec(query, videoID, *category)
+	return err
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+// Thumbnail is one rendition of a video's thumbnail. Together the
+// renditions of a video form a srcset the client can pick from.
+type Thumbnail struct {
+	URL      string `json:"url"`
+	Width    int    `json:"width"`
+	MimeType string `json:"mime_type"`
+}
+
+func (c Client) GetVideoThumbnails(videoID uuid.UUID) ([]Thumbnail, error) {
+	query := `
+	SELECT url, width, mime_type
+	FROM video_thumbnails
+	WHERE video_id = ?
+	ORDER BY mime_type, width
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	thumbnails := []Thumbnail{}
+	for rows.Next() {
+		var thumbnail Thumbnail
+		if err := rows.Scan(&thumbnail.URL, &thumbnail.Width, &thumbnail.MimeType); err != nil {
+			return nil, err
+		}
+		thumbnails = append(thumbnails, thumbnail)
+	}
+
+	return thumbnails, rows.Err()
+}
+
+// ReplaceVideoThumbnails swaps the whole set of renditions for a video
+// in a single transaction, so readers never see a half-written srcset.
+// The renditions replace the legacy thumbnail_url too. No other column of
+// the video is written, so concurrent edits of its details are kept.
+func (c Client) ReplaceVideoThumbnails(videoID uuid.UUID, thumbnails []Thumbnail) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE videos
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1,
+		thumbnail_url = NULL
+	WHERE id = ?
+	`
+	_, err = tx.Exec(query, videoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM video_thumbnails WHERE video_id = ?`, videoID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO video_thumbnails (
+		video_id,
+		width,
+		mime_type,
+		url
+	) VALUES (?, ?, ?, ?)
+	`
+	for _, thumbnail := range thumbnails {
+		_, err = tx.Exec(query, videoID, thumbnail.Width, thumbnail.MimeType, thumbnail.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
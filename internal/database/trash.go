@@ -0,0 +1,73 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrashVideo moves the video to the trash. It disappears from listings and
+// search until it is restored or purged.
+func (c Client) TrashVideo(id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// RestoreVideo takes the video back out of the trash.
+func (c Client) RestoreVideo(id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// GetTrashedVideos returns the user's videos in the trash, most recently
+// deleted first.
+func (c Client) GetTrashedVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id
+	`
+	return c.queryVideos(query, userID)
+}
+
+// GetVideosTrashedBefore returns every user's videos that went into the
+// trash before the cutoff, oldest first.
+func (c Client) GetVideosTrashedBefore(cutoff time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at < ?
+	ORDER BY deleted_at, id
+	`
+	return c.queryVideos(query, c.db.dialect.timeValue(cutoff))
+}
+
+// PurgeVideo deletes a video that went into the trash before the cutoff,
+// like DeleteVideo. It reports false, and leaves the video alone, when it
+// has been restored or trashed again since.
+func (c Client) PurgeVideo(id uuid.UUID, cutoff time.Time) (bool, error) {
+	query := `
+	DELETE FROM videos
+	WHERE id = ? AND deleted_at < ?
+	`
+	result, err := c.db.Exec(query, id, c.db.dialect.timeValue(cutoff))
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
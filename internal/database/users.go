@@ -137,6 +137,9 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
+// DeleteUser removes the user along with their refresh tokens, videos,
+// watermark and quota, which the foreign keys cascade to. Stored files are
+// left to the caller.
 func (c Client) DeleteUser(id uuid.UUID) error {
 	query := `
 		DELETE FROM users
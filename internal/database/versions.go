@@ -0,0 +1,463 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Where a version's file came from
+const (
+	VersionSourceUpload = "upload"
+	VersionSourceClip   = "clip"
+)
+
+// VideoVersion is one stored file of a video, with everything that was
+// derived from it. The video itself shows whichever version is current.
+type VideoVersion struct {
+	ID        uuid.UUID `json:"id"`
+	Number    int       `json:"number"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+	CreateVideoVersionParams
+}
+
+type CreateVideoVersionParams struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	Source   string    `json:"source"`
+	VideoURL string    `json:"video_url"`
+	// SizeBytes is what the version's video files take up in storage,
+	// the unwatermarked original included. It counts towards quotas.
+	SizeBytes        int64           `json:"size_bytes"`
+	OriginalVideoURL *string         `json:"-"`
+	PreviewURL       *string         `json:"preview_url"`
+	Loudness         *Loudness       `json:"loudness"`
+	Audio            *AudioRendition `json:"audio"`
+	// StrippedMetadata names the metadata removed from the upload, nil if
+	// it was kept. See Video.StrippedMetadata.
+	StrippedMetadata []string    `json:"stripped_metadata"`
+	Storyboard       *Storyboard `json:"storyboard"`
+}
+
+const versionColumns = `
+		v.id,
+		v.number,
+		v.created_at,
+		v.id = COALESCE(videos.current_version_id, ''),
+		v.video_id,
+		v.source,
+		v.video_url,
+		COALESCE(v.size_bytes, 0),
+		v.original_video_url,
+		v.preview_url,
+		v.loudness_measured_lufs,
+		v.loudness_measured_true_peak,
+		v.loudness_target_lufs,
+		v.audio_url,
+		v.audio_duration_seconds,
+		v.stripped_metadata
+`
+
+func scanVersion(row rowScanner) (VideoVersion, error) {
+	var version VideoVersion
+	var measuredLUFS, measuredTruePeak, targetLUFS sql.NullFloat64
+	var audioURL, strippedMetadata sql.NullString
+	var audioDuration sql.NullFloat64
+	err := row.Scan(
+		&version.ID,
+		&version.Number,
+		&version.CreatedAt,
+		&version.Current,
+		&version.VideoID,
+		&version.Source,
+		&version.VideoURL,
+		&version.SizeBytes,
+		&version.OriginalVideoURL,
+		&version.PreviewURL,
+		&measuredLUFS,
+		&measuredTruePeak,
+		&targetLUFS,
+		&audioURL,
+		&audioDuration,
+		&strippedMetadata,
+	)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	version.Audio = audioRendition(audioURL, audioDuration)
+	version.StrippedMetadata = splitMetadataList(strippedMetadata)
+
+	if targetLUFS.Valid {
+		version.Loudness = &Loudness{
+			MeasuredLUFS:     measuredLUFS.Float64,
+			MeasuredTruePeak: measuredTruePeak.Float64,
+			TargetLUFS:       targetLUFS.Float64,
+		}
+	}
+	return version, nil
+}
+
+// GetVideoVersions returns the versions of a video, newest first.
+func (c Client) GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `
+	SELECT` + versionColumns + `
+	FROM video_versions v
+	JOIN videos ON videos.id = v.video_id
+	WHERE v.video_id = ?
+	ORDER BY v.number DESC
+	`
+	return c.queryVersions(query, videoID)
+}
+
+// GetUnsizedVideoVersions returns the versions whose size isn't known,
+// the ones backfilled for videos uploaded before sizes were recorded.
+// Their size counts as 0 towards quotas until SetVideoVersionSize.
+func (c Client) GetUnsizedVideoVersions() ([]VideoVersion, error) {
+	query := `
+	SELECT` + versionColumns + `
+	FROM video_versions v
+	JOIN videos ON videos.id = v.video_id
+	WHERE COALESCE(v.size_bytes, 0) = 0
+	ORDER BY v.created_at, v.id
+	`
+	return c.queryVersions(query)
+}
+
+// SetVideoVersionSize records the size of a version's stored files.
+func (c Client) SetVideoVersionSize(id uuid.UUID, sizeBytes int64) error {
+	_, err := c.db.Exec(`UPDATE video_versions SET size_bytes = ? WHERE id = ?`, sizeBytes, id)
+	return err
+}
+
+func (c Client) queryVersions(query string, args ...any) ([]VideoVersion, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range versions {
+		versions[i].Storyboard, err = getStoryboard(c.db, "video_version_storyboards", "version_id", versions[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// GetVideoVersion returns a zero VideoVersion if the video has no such version.
+func (c Client) GetVideoVersion(videoID uuid.UUID, number int) (VideoVersion, error) {
+	query := `
+	SELECT` + versionColumns + `
+	FROM video_versions v
+	JOIN videos ON videos.id = v.video_id
+	WHERE v.video_id = ? AND v.number = ?
+	`
+
+	version, err := scanVersion(c.db.QueryRow(query, videoID, number))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+
+	version.Storyboard, err = getStoryboard(c.db, "video_version_storyboards", "version_id", version.ID)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	return version, nil
+}
+
+// CreateVideoVersion stores a new version, numbered after the video's
+// latest one, and makes it the current version of the video. It returns
+// ErrQuotaExceeded if the version's size takes the owner past the limits.
+func (c Client) CreateVideoVersion(params CreateVideoVersionParams, limits QuotaLimits) (VideoVersion, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	defer tx.Rollback()
+
+	if limits != (QuotaLimits{}) {
+		err = lockVideoOwner(tx, params.VideoID)
+		if err != nil {
+			return VideoVersion{}, err
+		}
+		var userID uuid.UUID
+		err = tx.QueryRow(`SELECT user_id FROM videos WHERE id = ?`, params.VideoID).Scan(&userID)
+		if err != nil {
+			return VideoVersion{}, err
+		}
+		err = checkQuota(tx, userID, limits, params.SizeBytes, 0)
+		if err != nil {
+			return VideoVersion{}, err
+		}
+	}
+
+	version, err := createVideoVersion(tx, params)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	err = setCurrentVersion(tx, version)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	version.Current = true
+	return version, nil
+}
+
+func createVideoVersion(q querier, params CreateVideoVersionParams) (VideoVersion, error) {
+	version := VideoVersion{
+		ID:                       uuid.New(),
+		CreatedAt:                time.Now().UTC(),
+		CreateVideoVersionParams: params,
+	}
+
+	err := q.QueryRow(`SELECT COALESCE(MAX(number), 0) + 1 FROM video_versions WHERE video_id = ?`, params.VideoID).Scan(&version.Number)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	measuredLUFS, measuredTruePeak, targetLUFS := loudnessColumns(params.Loudness)
+	audioURL, audioDuration := audioColumns(params.Audio)
+	query := `
+	INSERT INTO video_versions (
+		id,
+		video_id,
+		number,
+		created_at,
+		source,
+		video_url,
+		size_bytes,
+		original_video_url,
+		preview_url,
+		loudness_measured_lufs,
+		loudness_measured_true_peak,
+		loudness_target_lufs,
+		audio_url,
+		audio_duration_seconds,
+		stripped_metadata
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = q.Exec(
+		query,
+		version.ID,
+		params.VideoID,
+		version.Number,
+		version.CreatedAt,
+		params.Source,
+		params.VideoURL,
+		params.SizeBytes,
+		params.OriginalVideoURL,
+		params.PreviewURL,
+		measuredLUFS,
+		measuredTruePeak,
+		targetLUFS,
+		audioURL,
+		audioDuration,
+		joinMetadataList(params.StrippedMetadata),
+	)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	err = setStoryboard(q, "video_version_storyboards", "version_id", version.ID, params.Storyboard)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	return version, nil
+}
+
+// SetCurrentVersion points the video at one of its versions, e.g. to roll
+// back to an earlier upload.
+func (c Client) SetCurrentVersion(version VideoVersion) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setCurrentVersion(tx, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The video keeps a copy of the current version's files, so reading a
+// video never needs the versions table.
+func setCurrentVersion(q querier, version VideoVersion) error {
+	measuredLUFS, measuredTruePeak, targetLUFS := loudnessColumns(version.Loudness)
+	audioURL, audioDuration := audioColumns(version.Audio)
+	query := `
+	UPDATE videos
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1,
+		current_version_id = ?,
+		video_url = ?,
+		original_video_url = ?,
+		preview_url = ?,
+		loudness_measured_lufs = ?,
+		loudness_measured_true_peak = ?,
+		loudness_target_lufs = ?,
+		audio_url = ?,
+		audio_duration_seconds = ?,
+		stripped_metadata = ?
+	WHERE id = ?
+	`
+	_, err := q.Exec(
+		query,
+		version.ID,
+		version.VideoURL,
+		version.OriginalVideoURL,
+		version.PreviewURL,
+		measuredLUFS,
+		measuredTruePeak,
+		targetLUFS,
+		audioURL,
+		audioDuration,
+		joinMetadataList(version.StrippedMetadata),
+		version.VideoID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return setStoryboard(q, "video_storyboards", "video_id", version.VideoID, version.Storyboard)
+}
+
+// DeleteVideoVersion removes a version that is not current. Its stored
+// files are left to the caller.
+func (c Client) DeleteVideoVersion(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM videos WHERE current_version_id = ?`, id).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current > 0 {
+		return errors.New("can't delete the current version of a video")
+	}
+
+	_, err = tx.Exec(`DELETE FROM video_versions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backfillVideoVersions turns the file of every video uploaded before
+// versions existed into its version 1.
+func (c *Client) backfillVideoVersions() error {
+	rows, err := c.db.Query(`SELECT id FROM videos WHERE video_url IS NOT NULL AND current_version_id IS NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		video, err := c.GetVideo(id)
+		if err != nil {
+			return err
+		}
+		_, err = c.CreateVideoVersion(CreateVideoVersionParams{
+			VideoID:          video.ID,
+			Source:           VersionSourceUpload,
+			VideoURL:         *video.VideoURL,
+			OriginalVideoURL: video.OriginalVideoURL,
+			PreviewURL:       video.PreviewURL,
+			Loudness:         video.Loudness,
+			Audio:            video.Audio,
+			StrippedMetadata: video.StrippedMetadata,
+			Storyboard:       video.Storyboard,
+		}, QuotaLimits{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loudnessColumns(loudness *Loudness) (sql.NullFloat64, sql.NullFloat64, sql.NullFloat64) {
+	if loudness == nil {
+		return sql.NullFloat64{}, sql.NullFloat64{}, sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: loudness.MeasuredLUFS, Valid: true},
+		sql.NullFloat64{Float64: loudness.MeasuredTruePeak, Valid: true},
+		sql.NullFloat64{Float64: loudness.TargetLUFS, Valid: true}
+}
+
+func audioColumns(audio *AudioRendition) (sql.NullString, sql.NullFloat64) {
+	if audio == nil {
+		return sql.NullString{}, sql.NullFloat64{}
+	}
+	return sql.NullString{String: audio.AudioURL, Valid: true},
+		sql.NullFloat64{Float64: audio.DurationSeconds, Valid: true}
+}
+
+func audioRendition(url sql.NullString, duration sql.NullFloat64) *AudioRendition {
+	if !url.Valid {
+		return nil
+	}
+	return &AudioRendition{AudioURL: url.String, DurationSeconds: duration.Float64}
+}
+
+// Stripped metadata is stored one name per line. NULL means nothing was
+// stripped, as opposed to an empty list for a file without metadata.
+func joinMetadataList(names []string) sql.NullString {
+	if names == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.Join(names, "\n"), Valid: true}
+}
+
+func splitMetadataList(value sql.NullString) []string {
+	if !value.Valid {
+		return nil
+	}
+	if value.String == "" {
+		return []string{}
+	}
+	return strings.Split(value.String, "\n")
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued for the
+// requested sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// VideoSorts are the orders a video list can come in. A leading "-"
+// reverses the order, so "-created_at" is newest first.
+var VideoSorts = []string{"created_at", "-created_at", "updated_at", "-updated_at", "title", "-title"}
+
+const defaultVideoSort = "-created_at"
+
+// DefaultVideoPageSize is the page size when VideoListOptions.Limit is 0
+const DefaultVideoPageSize = 50
+
+// Aspect ratios are encoded in the S3 key the video is stored under
+var videoAspectRatios = map[string]bool{"landscape": true, "portrait": true, "other": true}
+
+// VideoListOptions narrows down and pages a user's videos. Zero values
+// don't filter.
+type VideoListOptions struct {
+	Limit  int
+	Cursor string
+	// Sort is one of VideoSorts, "-created_at" if empty
+	Sort         string
+	HasVideo     *bool
+	HasThumbnail *bool
+	// AspectRatio is landscape, portrait or other
+	AspectRatio   string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Tag only keeps videos with this tag, as NormalizeTags writes it
+	Tag string
+	// Category only keeps videos in this category
+	Category string
+}
+
+// VideoPage is one page of a video list. NextCursor is nil on the last
+// page, Total counts every video that matches the filters.
+type VideoPage struct {
+	Videos     []Video `json:"videos"`
+	NextCursor *string `json:"next_cursor"`
+	Total      int     `json:"total"`
+}
+
+// videoCursor is where a page ended: the sort key and ID of its last
+// video. Clients get it base64 encoded and pass it back unchanged.
+type videoCursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func ValidVideoSort(sort string) bool {
+	for _, s := range VideoSorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidAspectRatio(aspectRatio string) bool {
+	return videoAspectRatios[aspectRatio]
+}
+
+// GetVideoPage returns the user's videos matching opts, up to opts.Limit
+// of them, starting after opts.Cursor.
+func (c Client) GetVideoPage(userID uuid.UUID, opts VideoListOptions) (VideoPage, error) {
+	sort := opts.Sort
+	if sort == "" {
+		sort = defaultVideoSort
+	}
+	if !ValidVideoSort(sort) {
+		return VideoPage{}, errors.New("unknown sort " + sort)
+	}
+	column, descending := strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultVideoPageSize
+	}
+
+	where := []string{"user_id = ?", "deleted_at IS NULL"}
+	args := []any{userID}
+	if opts.HasVideo != nil {
+		where = append(where, nullCheck("video_url", *opts.HasVideo))
+	}
+	if opts.HasThumbnail != nil {
+		condition := "(thumbnail_url IS NOT NULL OR EXISTS (SELECT 1 FROM video_thumbnails t WHERE t.video_id = videos.id))"
+		if !*opts.HasThumbnail {
+			condition = "NOT " + condition
+		}
+		where = append(where, condition)
+	}
+	if opts.AspectRatio != "" {
+		if !ValidAspectRatio(opts.AspectRatio) {
+			return VideoPage{}, errors.New("unknown aspect ratio " + opts.AspectRatio)
+		}
+		where = append(where, "video_url LIKE ?")
+		args = append(args, "%,"+opts.AspectRatio+"/%")
+	}
+	if opts.Tag != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM video_tags vt JOIN tags t ON t.id = vt.tag_id WHERE vt.video_id = videos.id AND t.name = ?)")
+		args = append(args, opts.Tag)
+	}
+	if opts.Category != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM video_categories vc WHERE vc.video_id = videos.id AND vc.category = ?)")
+		args = append(args, opts.Category)
+	}
+	if opts.CreatedAfter != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, c.db.dialect.timeValue(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, c.db.dialect.timeValue(*opts.CreatedBefore))
+	}
+
+	var page VideoPage
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM videos WHERE `+strings.Join(where, " AND "), args...).Scan(&page.Total)
+	if err != nil {
+		return VideoPage{}, err
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := decodeVideoCursor(opts.Cursor)
+		if err != nil || cursor.Sort != sort {
+			return VideoPage{}, ErrInvalidCursor
+		}
+		var value any = cursor.Value
+		if column != "title" {
+			t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+			if err != nil {
+				return VideoPage{}, ErrInvalidCursor
+			}
+			value = c.db.dialect.timeValue(t)
+		}
+		op := ">"
+		if descending {
+			op = "<"
+		}
+		where = append(where, "("+column+" "+op+" ? OR ("+column+" = ? AND id "+op+" ?))")
+		args = append(args, value, value, cursor.ID)
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY ` + column + ` ` + direction + `, id ` + direction + `
+	LIMIT ?
+	`
+	// One extra row says whether there is a next page
+	rows, err := c.db.Query(query, append(args, opts.Limit+1)...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	page.Videos = []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoPage{}, err
+	}
+	rows.Close()
+
+	if len(page.Videos) > opts.Limit {
+		page.Videos = page.Videos[:opts.Limit]
+		last := page.Videos[len(page.Videos)-1]
+		cursor := videoCursor{Sort: sort, ID: last.ID, Value: last.Title}
+		switch column {
+		case "created_at":
+			cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+		case "updated_at":
+			cursor.Value = last.UpdatedAt.Format(time.RFC3339Nano)
+		}
+		encoded, err := encodeVideoCursor(cursor)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		page.NextCursor = &encoded
+	}
+
+	for i := range page.Videos {
+		if err := c.attachMedia(&page.Videos[i]); err != nil {
+			return VideoPage{}, err
+		}
+	}
+	return page, nil
+}
+
+func nullCheck(column string, notNull bool) string {
+	if notNull {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
+
+func encodeVideoCursor(cursor videoCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeVideoCursor(encoded string) (videoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return videoCursor{}, err
+	}
+	var cursor videoCursor
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,20 +13,63 @@ type Video struct {
 	ID           uuid.UUID `json:"id"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
+	ThumbnailURL *string   `json:"-"`
 	VideoURL     *string   `json:"video_url"`
+	// OriginalVideoURL points at the unwatermarked upload when VideoURL
+	// has a watermark burnt in. It is never sent to clients.
+	OriginalVideoURL *string `json:"-"`
+	PreviewURL       *string `json:"preview_url"`
+	// CurrentVersionID is the version VideoURL and the other file
+	// fields were copied from, nil until a file is uploaded
+	CurrentVersionID *uuid.UUID `json:"current_version_id"`
+	// Thumbnails holds every resized rendition of the thumbnail,
+	// srcset style. ThumbnailURL is only kept for videos whose
+	// thumbnail was uploaded before renditions existed.
+	Thumbnails []Thumbnail `json:"thumbnails"`
+	Captions   []Caption   `json:"captions"`
+	Storyboard *Storyboard `json:"storyboard"`
+	// Loudness is nil unless the audio was normalised during processing
+	Loudness *Loudness `json:"loudness"`
+	// Audio is nil unless an audio-only rendition was extracted
+	Audio *AudioRendition `json:"audio"`
+	// StrippedMetadata names the metadata (location, device, ...) removed
+	// from the uploaded file, like "format:location". Nil if the upload
+	// kept its metadata.
+	StrippedMetadata []string `json:"stripped_metadata"`
+	// DeletedAt is when the video was moved to the trash, nil otherwise
+	DeletedAt *time.Time `json:"deleted_at"`
+	// Version goes up by one with every write to the video, see
+	// UpdateVideoDetails. It has nothing to do with VideoVersion.
+	Version int `json:"version"`
 	CreateVideoParams
 }
 
+// AudioRendition is the video's audio track on its own, as M4A, for
+// listening in the background.
+type AudioRendition struct {
+	AudioURL        string  `json:"url"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Loudness records an EBU R128 normalisation pass: what ffmpeg measured
+// on the upload and the integrated loudness it was re-encoded to.
+type Loudness struct {
+	MeasuredLUFS     float64 `json:"measured_lufs"`
+	MeasuredTruePeak float64 `json:"measured_true_peak"`
+	TargetLUFS       float64 `json:"target_lufs"`
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
+	// Tags are normalised on the way in, see NormalizeTags
+	Tags []string `json:"tags"`
+	// Category is the slug of one of GetCategories, or nil
+	Category *string `json:"category"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,13 +77,89 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
+		user_id,
+		loudness_measured_lufs,
+		loudness_measured_true_peak,
+		loudness_target_lufs,
+		original_video_url,
+		preview_url,
+		current_version_id,
+		audio_url,
+		audio_duration_seconds,
+		stripped_metadata,
+		deleted_at,
+		version
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// querier is what *sql.DB and *sql.Tx have in common, so helpers can run
+// on their own or as part of a transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	var measuredLUFS, measuredTruePeak, targetLUFS sql.NullFloat64
+	var audioURL, strippedMetadata sql.NullString
+	var audioDuration sql.NullFloat64
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.UserID,
+		&measuredLUFS,
+		&measuredTruePeak,
+		&targetLUFS,
+		&video.OriginalVideoURL,
+		&video.PreviewURL,
+		&video.CurrentVersionID,
+		&audioURL,
+		&audioDuration,
+		&strippedMetadata,
+		&video.DeletedAt,
+		&video.Version,
+	)
+	if err != nil {
+		return Video{}, err
+	}
+	video.Audio = audioRendition(audioURL, audioDuration)
+	video.StrippedMetadata = splitMetadataList(strippedMetadata)
+
+	if targetLUFS.Valid {
+		video.Loudness = &Loudness{
+			MeasuredLUFS:     measuredLUFS.Float64,
+			MeasuredTruePeak: measuredTruePeak.Float64,
+			TargetLUFS:       targetLUFS.Float64,
+		}
+	}
+
+	return video, nil
+}
+
+// GetVideos returns the user's videos, newest first, leaving out the
+// ones in the trash.
+func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE user_id = ?
+	WHERE user_id = ? AND deleted_at IS NULL
 	ORDER BY created_at DESC
 	`
+	return c.queryVideos(query, userID)
+}
 
-	rows, err := c.db.Query(query, userID)
+func (c Client) queryVideos(query string, args ...any) ([]Video, error) {
+	rows, err := c.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,27 +167,89 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range videos {
+		if err := c.attachMedia(&videos[i]); err != nil {
+			return nil, err
+		}
+	}
 
 	return videos, nil
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	id := uuid.New()
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	err = createVideo(tx, id, params)
+	if err != nil {
+		return Video{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return Video{}, err
+	}
+
+	return c.GetVideo(id)
+}
+
+// CreateVideoWithVersion creates the video with the given id and its
+// first version in one transaction, so a failure leaves neither behind.
+// version.VideoID is set to id. It returns ErrQuotaExceeded if one more
+// video of that size takes the user past the limits.
+func (c Client) CreateVideoWithVersion(id uuid.UUID, params CreateVideoParams, version CreateVideoVersionParams, limits QuotaLimits) (Video, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	if limits != (QuotaLimits{}) {
+		err = lockUser(tx, params.UserID)
+		if err != nil {
+			return Video{}, err
+		}
+		err = checkQuota(tx, params.UserID, limits, version.SizeBytes, 1)
+		if err != nil {
+			return Video{}, err
+		}
+	}
+	err = createVideo(tx, id, params)
+	if err != nil {
+		return Video{}, err
+	}
+	version.VideoID = id
+	created, err := createVideoVersion(tx, version)
+	if err != nil {
+		return Video{}, err
+	}
+	err = setCurrentVersion(tx, created)
+	if err != nil {
+		return Video{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return Video{}, err
+	}
+
+	return c.GetVideo(id)
+}
+
+func createVideo(q querier, id uuid.UUID, params CreateVideoParams) error {
 	query := `
 	INSERT INTO videos (
 		id,
@@ -78,39 +260,29 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		user_id
 	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := q.Exec(query, id, params.Title, params.Description, params.UserID)
 	if err != nil {
-		return Video{}, err
+		return err
 	}
-
-	return c.GetVideo(id)
+	err = setVideoTags(q, id, params.UserID, params.Tags)
+	if err != nil {
+		return err
+	}
+	if params.Category != nil {
+		return setVideoCategory(q, id, params.Category)
+	}
+	return nil
 }
 
+// GetVideo returns the video even when it is in the trash, see DeletedAt.
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,21 +290,79 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
+	if err := c.attachMedia(&video); err != nil {
+		return Video{}, err
+	}
+
 	return video, nil
 }
 
+// attachMedia loads the thumbnail renditions, caption tracks, storyboard,
+// tags and category of a video. Videos that only have a legacy thumbnail_url get it as a single
+// rendition of unknown width.
+func (c Client) attachMedia(video *Video) error {
+	thumbnails, err := c.GetVideoThumbnails(video.ID)
+	if err != nil {
+		return err
+	}
+	if len(thumbnails) == 0 && video.ThumbnailURL != nil {
+		thumbnails = append(thumbnails, Thumbnail{URL: *video.ThumbnailURL})
+	}
+	video.Thumbnails = thumbnails
+
+	video.Captions, err = c.GetCaptions(video.ID)
+	if err != nil {
+		return err
+	}
+
+	video.Storyboard, err = c.GetStoryboard(video.ID)
+	if err != nil {
+		return err
+	}
+
+	video.Tags, err = c.GetVideoTags(video.ID)
+	if err != nil {
+		return err
+	}
+
+	video.Category, err = c.GetVideoCategory(video.ID)
+	return err
+}
+
+// UpdateVideo stores the video's own columns and bumps updated_at and
+// version. Tags
+// and category are set with SetVideoTags and SetVideoCategory.
 func (c Client) UpdateVideo(video Video) error {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		user_id = ?,
+		loudness_measured_lufs = ?,
+		loudness_measured_true_peak = ?,
+		loudness_target_lufs = ?,
+		original_video_url = ?,
+		preview_url = ?,
+		audio_url = ?,
+		audio_duration_seconds = ?,
+		stripped_metadata = ?
 	WHERE id = ?
 	`
 
+	var measuredLUFS, measuredTruePeak, targetLUFS sql.NullFloat64
+	if video.Loudness != nil {
+		measuredLUFS = sql.NullFloat64{Float64: video.Loudness.MeasuredLUFS, Valid: true}
+		measuredTruePeak = sql.NullFloat64{Float64: video.Loudness.MeasuredTruePeak, Valid: true}
+		targetLUFS = sql.NullFloat64{Float64: video.Loudness.TargetLUFS, Valid: true}
+	}
+
+	audioURL, audioDuration := audioColumns(video.Audio)
+
 	_, err := c.db.Exec(
 		query,
 		video.Title,
@@ -140,11 +370,97 @@ func (c Client) UpdateVideo(video Video) error {
 		&video.ThumbnailURL,
 		&video.VideoURL,
 		video.UserID,
+		measuredLUFS,
+		measuredTruePeak,
+		targetLUFS,
+		video.OriginalVideoURL,
+		video.PreviewURL,
+		audioURL,
+		audioDuration,
+		joinMetadataList(video.StrippedMetadata),
 		video.ID,
 	)
 	return err
 }
 
+// ErrVideoModified is returned by UpdateVideoDetails when the video was
+// changed since the caller read it
+var ErrVideoModified = errors.New("video was modified")
+
+// VideoDetails are the fields of a video its owner edits. Nil fields are
+// left as they are.
+type VideoDetails struct {
+	Title       *string
+	Description *string
+	// Tags replaces every tag, see NormalizeTags
+	Tags *[]string
+	// Category is the new category when SetCategory is true, nil for none
+	Category    *string
+	SetCategory bool
+}
+
+// UpdateVideoDetails applies the changes and bumps updated_at and version.
+// With ifVersion set it only does so if the video is still at that
+// version, returning ErrVideoModified otherwise.
+func (c Client) UpdateVideoDetails(id uuid.UUID, details VideoDetails, ifVersion *int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	set := []string{"updated_at = CURRENT_TIMESTAMP", "version = version + 1"}
+	args := []any{}
+	if details.Title != nil {
+		set = append(set, "title = ?")
+		args = append(args, *details.Title)
+	}
+	if details.Description != nil {
+		set = append(set, "description = ?")
+		args = append(args, *details.Description)
+	}
+	where := "id = ?"
+	args = append(args, id)
+	if ifVersion != nil {
+		where += " AND version = ?"
+		args = append(args, *ifVersion)
+	}
+
+	result, err := tx.Exec(`UPDATE videos SET `+strings.Join(set, ", ")+` WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrVideoModified
+	}
+
+	if details.Tags != nil {
+		var userID uuid.UUID
+		err = tx.QueryRow(`SELECT user_id FROM videos WHERE id = ?`, id).Scan(&userID)
+		if err != nil {
+			return err
+		}
+		err = setVideoTags(tx, id, userID, *details.Tags)
+		if err != nil {
+			return err
+		}
+	}
+	if details.SetCategory {
+		err = setVideoCategory(tx, id, details.Category)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteVideo removes the video and, through the foreign keys, its
+// thumbnails, captions, storyboard and versions. Stored files are left to
+// the caller.
 func (c Client) DeleteVideo(id uuid.UUID) error {
 	query := `
 	DELETE FROM videos
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Watermark is a user's own watermark image and how to overlay it.
+// ImagePath is the file name of the image inside the assets directory.
+type Watermark struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ImagePath string    `json:"-"`
+	Position  string    `json:"position"`
+	Opacity   float64   `json:"opacity"`
+	Scale     float64   `json:"scale"`
+}
+
+// GetWatermark returns nil if the user hasn't set up a watermark.
+func (c Client) GetWatermark(userID uuid.UUID) (*Watermark, error) {
+	query := `
+	SELECT user_id, created_at, updated_at, image_path, position, opacity, scale
+	FROM user_watermarks
+	WHERE user_id = ?
+	`
+
+	var watermark Watermark
+	err := c.db.QueryRow(query, userID).Scan(
+		&watermark.UserID,
+		&watermark.CreatedAt,
+		&watermark.UpdatedAt,
+		&watermark.ImagePath,
+		&watermark.Position,
+		&watermark.Opacity,
+		&watermark.Scale,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &watermark, nil
+}
+
+func (c Client) UpsertWatermark(watermark Watermark) (*Watermark, error) {
+	query := `
+	INSERT INTO user_watermarks (
+		user_id,
+		created_at,
+		updated_at,
+		image_path,
+		position,
+		opacity,
+		scale
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		image_path = excluded.image_path,
+		position = excluded.position,
+		opacity = excluded.opacity,
+		scale = excluded.scale
+	`
+	_, err := c.db.Exec(
+		query,
+		watermark.UserID,
+		watermark.ImagePath,
+		watermark.Position,
+		watermark.Opacity,
+		watermark.Scale,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetWatermark(watermark.UserID)
+}
+
+func (c Client) DeleteWatermark(userID uuid.UUID) error {
+	query := `
+	DELETE FROM user_watermarks
+	WHERE user_id = ?
+	`
+	_, err := c.db.Exec(query, userID)
+	return err
+}
@@ -0,0 +1,79 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned instead of queueing a run once as many runs
+// are already waiting for a slot as the queue holds.
+var ErrQueueFull = errors.New("media queue is full")
+
+// pool bounds how many processes of one kind run at the same time, and
+// how many more may wait for their turn. A nil pool doesn't limit anything.
+type pool struct {
+	slots    chan struct{}
+	mu       sync.Mutex
+	waiting  int
+	maxQueue int
+}
+
+func newPool(workers, queue int) *pool {
+	if workers <= 0 {
+		return nil
+	}
+	return &pool{
+		slots:    make(chan struct{}, workers),
+		maxQueue: max(0, queue),
+	}
+}
+
+// acquire takes a slot, waiting in the queue if none is free. The
+// returned func gives the slot back.
+func (p *pool) acquire(ctx context.Context) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	default:
+	}
+
+	p.mu.Lock()
+	if p.waiting >= p.maxQueue {
+		p.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	p.waiting++
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.waiting--
+		p.mu.Unlock()
+	}()
+
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *pool) release() {
+	<-p.slots
+}
+
+// full reports whether a new run would be turned away right now
+func (p *pool) full() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.slots) == cap(p.slots) && p.waiting >= p.maxQueue
+}
@@ -0,0 +1,76 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type ProbeStream struct {
+	Index     int               `json:"index"`
+	CodecType string            `json:"codec_type"`
+	CodecName string            `json:"codec_name"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Tags      map[string]string `json:"tags"`
+}
+
+type ProbeFormat struct {
+	Duration string            `json:"duration"`
+	Tags     map[string]string `json:"tags"`
+}
+
+// ProbeResult is the part of `ffprobe -show_streams -show_format` we use
+type ProbeResult struct {
+	Streams []ProbeStream `json:"streams"`
+	Format  ProbeFormat   `json:"format"`
+}
+
+func (r *Runner) Probe(ctx context.Context, filePath string) (ProbeResult, error) {
+	result, err := r.FFprobe(ctx, "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filePath)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+
+	data := ProbeResult{}
+	err = json.Unmarshal(result.Stdout, &data)
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("couldn't parse ffprobe output: %w", err)
+	}
+	return data, nil
+}
+
+// VideoStream returns the first video stream, if any
+func (p ProbeResult) VideoStream() (ProbeStream, bool) {
+	for _, stream := range p.Streams {
+		if stream.CodecType == "video" {
+			return stream, true
+		}
+	}
+	return ProbeStream{}, false
+}
+
+// AudioStream returns the first audio stream, if any
+func (p ProbeResult) AudioStream() (ProbeStream, bool) {
+	for _, stream := range p.Streams {
+		if stream.CodecType == "audio" {
+			return stream, true
+		}
+	}
+	return ProbeStream{}, false
+}
+
+func (p ProbeResult) HasAudio() bool {
+	_, ok := p.AudioStream()
+	return ok
+}
+
+// Duration of the container in seconds
+func (p ProbeResult) Duration() (float64, error) {
+	duration, err := strconv.ParseFloat(p.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", p.Format.Duration, err)
+	}
+	return duration, nil
+}
@@ -0,0 +1,66 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// ProgressFunc receives how far an ffmpeg run is, from 0 to 100
+type ProgressFunc func(percent float64)
+
+type progressKey struct{}
+
+type progressReporter struct {
+	duration float64
+	report   ProgressFunc
+}
+
+// WithProgress makes every FFmpeg call made with the returned context
+// report its progress through report. duration is the length of the input
+// in seconds, which ffmpeg's output position is measured against.
+func WithProgress(ctx context.Context, duration float64, report ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, progressReporter{duration: duration, report: report})
+}
+
+// progressWriter parses the key=value lines ffmpeg writes with -progress,
+// e.g. "out_time_us=1500000" and, last, "progress=end".
+type progressWriter struct {
+	reporter progressReporter
+	pending  []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i == -1 {
+			break
+		}
+		w.parseLine(string(bytes.TrimSpace(w.pending[:i])))
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) parseLine(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+
+	switch key {
+	case "out_time_us":
+		micros, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || micros < 0 {
+			return
+		}
+		percent := float64(micros) / 1e6 / w.reporter.duration * 100
+		w.reporter.report(min(percent, 100))
+	case "progress":
+		if value == "end" {
+			w.reporter.report(100)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package media runs ffmpeg and ffprobe with timeouts, cancellation and
+// captured stderr, so a failing or hung process never shows up as a bare
+// "exit status 1" or blocks a request forever.
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	FFmpegPath  string
+	FFprobePath string
+	// Per-run limits. Zero means no timeout besides the caller's context.
+	FFmpegTimeout  time.Duration
+	FFprobeTimeout time.Duration
+	// How many trailing bytes of stderr are kept for results and errors
+	MaxStderr int
+	// How many remuxes (stream copies, probes and other light runs) and
+	// transcodes may run at once. Zero means unlimited.
+	RemuxWorkers     int
+	TranscodeWorkers int
+	// How many runs of each kind may wait for a worker before new ones
+	// fail with ErrQueueFull
+	QueueSize int
+}
+
+type Runner struct {
+	ffmpegPath     string
+	ffprobePath    string
+	ffmpegTimeout  time.Duration
+	ffprobeTimeout time.Duration
+	maxStderr      int
+	remux          *pool
+	transcode      *pool
+}
+
+const defaultMaxStderr = 8 << 10
+
+func NewRunner(cfg Config) *Runner {
+	r := &Runner{
+		ffmpegPath:     cfg.FFmpegPath,
+		ffprobePath:    cfg.FFprobePath,
+		ffmpegTimeout:  cfg.FFmpegTimeout,
+		ffprobeTimeout: cfg.FFprobeTimeout,
+		maxStderr:      cfg.MaxStderr,
+		remux:          newPool(cfg.RemuxWorkers, cfg.QueueSize),
+		transcode:      newPool(cfg.TranscodeWorkers, cfg.QueueSize),
+	}
+	if r.ffmpegPath == "" {
+		r.ffmpegPath = "ffmpeg"
+	}
+	if r.ffprobePath == "" {
+		r.ffprobePath = "ffprobe"
+	}
+	if r.maxStderr <= 0 {
+		r.maxStderr = defaultMaxStderr
+	}
+	return r
+}
+
+// Result is the output of a successful run. Stderr is truncated to the
+// last MaxStderr bytes.
+type Result struct {
+	Stdout []byte
+	Stderr string
+}
+
+// Error is returned for any run that didn't exit cleanly.
+type Error struct {
+	Binary   string
+	Args     []string
+	Stderr   string
+	TimedOut bool
+	Err      error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s failed: %v", e.Binary, e.Err)
+	if e.TimedOut {
+		msg = fmt.Sprintf("%s timed out: %v", e.Binary, e.Err)
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CheckBinaries makes sure ffmpeg and ffprobe can be started, so a
+// missing install fails at startup instead of on the first upload.
+func (r *Runner) CheckBinaries(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, binary := range []string{r.ffmpegPath, r.ffprobePath} {
+		path, err := exec.LookPath(binary)
+		if err != nil {
+			return fmt.Errorf("couldn't find %s: %w", binary, err)
+		}
+		_, err = r.run(ctx, nil, path, 0, []string{"-version"}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Busy reports whether new runs of either kind would fail with
+// ErrQueueFull, so callers can turn work away before starting on it.
+func (r *Runner) Busy() bool {
+	return r.remux.full() || r.transcode.full()
+}
+
+// FFmpeg runs ffmpeg with args as a transcode. -hide_banner and -nostdin
+// are always added: the banner only pollutes captured stderr, and ffmpeg
+// must never wait on the server's stdin. If ctx carries a progress
+// reporter (see WithProgress), ffmpeg's -progress output is parsed and
+// reported.
+func (r *Runner) FFmpeg(ctx context.Context, args ...string) (Result, error) {
+	return r.ffmpeg(ctx, r.transcode, args)
+}
+
+// Remux runs ffmpeg like FFmpeg, for runs that copy the video stream
+// instead of encoding it and so only need one of the cheaper remux workers.
+func (r *Runner) Remux(ctx context.Context, args ...string) (Result, error) {
+	return r.ffmpeg(ctx, r.remux, args)
+}
+
+func (r *Runner) ffmpeg(ctx context.Context, workers *pool, args []string) (Result, error) {
+	var progress io.Writer
+	if reporter, ok := ctx.Value(progressKey{}).(progressReporter); ok && reporter.duration > 0 {
+		args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+		progress = &progressWriter{reporter: reporter}
+	}
+	args = append([]string{"-hide_banner", "-nostdin"}, args...)
+	return r.run(ctx, workers, r.ffmpegPath, r.ffmpegTimeout, args, progress)
+}
+
+// FFprobe runs ffprobe with args, on a remux worker
+func (r *Runner) FFprobe(ctx context.Context, args ...string) (Result, error) {
+	return r.run(ctx, r.remux, r.ffprobePath, r.ffprobeTimeout, args, nil)
+}
+
+// run captures stdout, unless progress is set: then stdout is streamed to
+// it instead and Result.Stdout stays empty. Time spent waiting for a
+// worker doesn't count towards the timeout.
+func (r *Runner) run(ctx context.Context, workers *pool, binary string, timeout time.Duration, args []string, progress io.Writer) (Result, error) {
+	release, err := workers.acquire(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", binary, err)
+	}
+	defer release()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	// Don't wait forever on pipes held open by children of a killed process
+	cmd.WaitDelay = 5 * time.Second
+
+	var stdout bytes.Buffer
+	stderr := &tailBuffer{max: r.maxStderr}
+	cmd.Stdout = &stdout
+	if progress != nil {
+		cmd.Stdout = progress
+	}
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if err != nil {
+		runErr := &Error{
+			Binary: binary,
+			Args:   args,
+			Stderr: stderr.String(),
+			Err:    err,
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			runErr.Err = ctxErr
+			runErr.TimedOut = errors.Is(ctxErr, context.DeadlineExceeded)
+		}
+		return Result{}, runErr
+	}
+
+	return Result{Stdout: stdout.Bytes(), Stderr: stderr.String()}, nil
+}
+
+// tailBuffer keeps only the last max bytes written to it, which is where
+// ffmpeg puts the line that explains a failure.
+type tailBuffer struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	if b.truncated {
+		return "[truncated] ..." + string(b.buf)
+	}
+	return string(b.buf)
+}
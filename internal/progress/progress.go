@@ -0,0 +1,156 @@
+// Package progress fans out upload and processing progress of videos to
+// any number of listeners, e.g. Server-Sent Events streams.
+package progress
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Stage string
+
+const (
+	StageReceiving  Stage = "receiving"
+	StageProcessing Stage = "processing"
+	StageUploading  Stage = "uploading"
+	StageCompleted  Stage = "completed"
+	StageFailed     Stage = "failed"
+)
+
+type Event struct {
+	Stage Stage `json:"stage"`
+	// Step names the ffmpeg pass while processing, e.g. "faststart"
+	Step          string  `json:"step,omitempty"`
+	Percent       float64 `json:"percent"`
+	BytesReceived int64   `json:"bytes_received,omitempty"`
+	BytesTotal    int64   `json:"bytes_total,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Done reports whether no more events will follow this one
+func (e Event) Done() bool {
+	return e.Stage == StageCompleted || e.Stage == StageFailed
+}
+
+type Hub struct {
+	mu        sync.Mutex
+	jobs      map[uuid.UUID]*job
+	retention time.Duration
+}
+
+// job is the progress of a video's latest upload. Each Start bumps
+// generation, so timers left by an earlier upload leave it alone.
+type job struct {
+	upload     string
+	generation int
+	last       Event
+	// subscribers maps each listener to the upload it asked for, "" for
+	// whichever is running
+	subscribers map[chan Event]string
+}
+
+// NewHub returns a hub that forgets a video's final event retention after
+// it was published, so clients that connect late still see the outcome.
+func NewHub(retention time.Duration) *Hub {
+	return &Hub{
+		jobs:      map[uuid.UUID]*job{},
+		retention: retention,
+	}
+}
+
+func (h *Hub) job(videoID uuid.UUID) *job {
+	j, ok := h.jobs[videoID]
+	if !ok {
+		j = &job{subscribers: map[chan Event]string{}}
+		h.jobs[videoID] = j
+	}
+	return j
+}
+
+// Start begins a new upload of the video, identified by uploadID, which
+// may be empty. The previous upload's outcome is forgotten, so listeners
+// don't mistake it for this one's.
+func (h *Hub) Start(videoID uuid.UUID, uploadID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	j := h.job(videoID)
+	j.upload = uploadID
+	j.generation++
+	j.last = Event{}
+}
+
+// Publish records e as the latest state of the video's current upload and
+// passes it on. Listeners that fall behind only get the latest event:
+// progress is a state, not a log, and publishers never block on slow
+// clients.
+func (h *Hub) Publish(videoID uuid.UUID, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	j := h.job(videoID)
+	j.last = e
+
+	for ch, uploadID := range j.subscribers {
+		if uploadID != "" && uploadID != j.upload {
+			continue
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- e
+	}
+
+	if e.Done() {
+		generation := j.generation
+		time.AfterFunc(h.retention, func() {
+			h.forget(videoID, j, generation)
+		})
+	}
+}
+
+// Subscribe returns a channel of the video's events, starting with the
+// latest one if there is any. With an uploadID it only gets the events of
+// that upload, whether it started yet or not. Call the returned func to
+// stop listening.
+func (h *Hub) Subscribe(videoID uuid.UUID, uploadID string) (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	j := h.job(videoID)
+	ch := make(chan Event, 1)
+	if j.last.Stage != "" && (uploadID == "" || uploadID == j.upload) {
+		ch <- j.last
+	}
+	j.subscribers[ch] = uploadID
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(j.subscribers, ch)
+		if j.last.Stage == "" && len(j.subscribers) == 0 && h.jobs[videoID] == j {
+			delete(h.jobs, videoID)
+		}
+	}
+}
+
+// forget drops a finished job, unless a new upload has started since.
+// While someone is still listening it checks again later.
+func (h *Hub) forget(videoID uuid.UUID, j *job, generation int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.jobs[videoID] != j || j.generation != generation || !j.last.Done() {
+		return
+	}
+	if len(j.subscribers) > 0 {
+		time.AfterFunc(h.retention, func() {
+			h.forget(videoID, j, generation)
+		})
+		return
+	}
+	delete(h.jobs, videoID)
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd
+
+package scratch
+
+func freeBytes(path string) (int64, error) {
+	return 0, ErrFreeSpaceUnknown
+}
@@ -0,0 +1,103 @@
+// Package scratch manages the directory uploads are processed in: every
+// job gets its own subdirectory, removed when the job is done, and
+// whatever a crash leaves behind is swept up later.
+package scratch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrFreeSpaceUnknown is returned by FreeBytes on platforms where the
+// free space of a filesystem can't be queried.
+var ErrFreeSpaceUnknown = errors.New("free space unknown on this platform")
+
+// Every job dir, and every temp file of versions before scratch dirs,
+// starts with jobPrefix. Sweeps only touch those, so the scratch dir can
+// safely be shared, e.g. be the system temp dir.
+const jobPrefix = "tubely-"
+
+type Dir struct {
+	path string
+}
+
+// New creates the scratch directory if it doesn't exist yet.
+func New(path string) (*Dir, error) {
+	err := os.MkdirAll(path, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Dir{path: path}, nil
+}
+
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Job creates a private working directory for one job, e.g. "upload".
+// Remove it with os.RemoveAll when done.
+func (d *Dir) Job(name string) (string, error) {
+	return os.MkdirTemp(d.path, jobPrefix+name+"-*")
+}
+
+// FreeBytes is how much space is left for unprivileged users on the
+// filesystem the scratch directory lives on.
+func (d *Dir) FreeBytes() (int64, error) {
+	return freeBytes(d.path)
+}
+
+// Sweep removes the job dirs and temp files in dir that weren't modified
+// for maxAge: leftovers of jobs that never cleaned up after themselves,
+// because the server crashed or was killed.
+func Sweep(dir string, maxAge time.Duration) (int, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, jobPrefix+"*"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-maxAge)
+	for _, match := range matches {
+		info, err := os.Lstat(match)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(match); err != nil {
+			log.Printf("Couldn't remove stale scratch file %s: %v\n", match, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Sweep removes stale entries of the scratch directory, see Sweep.
+func (d *Dir) Sweep(maxAge time.Duration) (int, error) {
+	return Sweep(d.path, maxAge)
+}
+
+// StartSweeper sweeps the scratch directory every interval until ctx is
+// done.
+func (d *Dir) StartSweeper(ctx context.Context, interval, maxAge time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				removed, err := d.Sweep(maxAge)
+				if err != nil {
+					log.Printf("Couldn't sweep scratch dir %s: %v\n", d.path, err)
+				} else if removed > 0 {
+					log.Printf("Removed %d stale entries from scratch dir %s\n", removed, d.path)
+				}
+			}
+		}
+	}()
+}
@@ -6,17 +6,24 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/scratch"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
+	db               database.Repository
 	jwtSecret        string
 	platform         string
 	filepathRoot     string
@@ -26,6 +33,18 @@ type apiConfig struct {
 	s3CfDistribution string
 	port             string
 	s3Client		*s3.Client		// CH3 L7
+	loudnessNormalize  bool
+	loudnessTargetLUFS float64
+	audioRendition     bool
+	quota              quotaLimits
+	adminEmails        map[string]bool
+	watermark          watermarkSettings
+	media              *media.Runner
+	progress           *progress.Hub
+	scratch            *scratch.Dir
+	scratchMinFree     int64
+	trashRetention     time.Duration
+	trustProxyHeaders  bool
 }
 
 type thumbnail struct {
@@ -36,15 +55,31 @@ type thumbnail struct {
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
+	// DB_URL takes a postgres:// URL or a SQLite path, DB_PATH is the
+	// older name for the latter
+	pathToDB := os.Getenv("DB_URL")
+	if pathToDB == "" {
+		pathToDB = os.Getenv("DB_PATH")
+	}
 	if pathToDB == "" {
 		log.Fatal("DB_URL must be set")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(pathToDB, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	db, err := database.NewClient(pathToDB)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
+	if !db.RankedSearch() {
+		log.Println("Warning: SQLite was built without FTS5, video search falls back to unranked substring matching. Build with -tags sqlite_fts5 to fix.")
+	}
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
@@ -86,6 +121,194 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	// Optional: loudness normalisation is off unless enabled here or per upload
+	loudnessNormalize := false
+	if value := os.Getenv("LOUDNESS_NORMALIZE"); value != "" {
+		loudnessNormalize, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("LOUDNESS_NORMALIZE must be a boolean: %v", err)
+		}
+	}
+
+	loudnessTargetLUFS := -16.0
+	if value := os.Getenv("LOUDNESS_TARGET_LUFS"); value != "" {
+		loudnessTargetLUFS, err = strconv.ParseFloat(value, 64)
+		if err != nil || loudnessTargetLUFS < -70 || loudnessTargetLUFS > -5 {
+			log.Fatalf("LOUDNESS_TARGET_LUFS must be a number between -70 and -5: %q", value)
+		}
+	}
+
+	// Optional: audio-only renditions are off unless enabled here or per upload
+	audioRendition := false
+	if value := os.Getenv("AUDIO_RENDITION"); value != "" {
+		audioRendition, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("AUDIO_RENDITION must be a boolean: %v", err)
+		}
+	}
+
+	// Optional: default per-user quotas, unlimited unless set. Admins can
+	// override them per user.
+	quota := quotaLimits{}
+	if value := os.Getenv("QUOTA_MAX_BYTES"); value != "" {
+		quota.MaxBytes, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || quota.MaxBytes < 0 {
+			log.Fatalf("QUOTA_MAX_BYTES must be a non-negative number: %q", value)
+		}
+	}
+	if value := os.Getenv("QUOTA_MAX_VIDEOS"); value != "" {
+		quota.MaxVideos, err = strconv.Atoi(value)
+		if err != nil || quota.MaxVideos < 0 {
+			log.Fatalf("QUOTA_MAX_VIDEOS must be a non-negative number: %q", value)
+		}
+	}
+	if value := os.Getenv("QUOTA_MAX_DURATION"); value != "" {
+		maxDuration, err := time.ParseDuration(value)
+		if err != nil || maxDuration < 0 {
+			log.Fatalf("QUOTA_MAX_DURATION must be a duration: %q", value)
+		}
+		quota.MaxDurationSeconds = maxDuration.Seconds()
+	}
+
+	adminEmails := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			adminEmails[strings.ToLower(email)] = true
+		}
+	}
+
+	// Optional: where uploads are processed, how much free space to leave
+	// there, and after how long leftovers of crashed jobs are swept up
+	scratchPath := os.Getenv("SCRATCH_DIR")
+	if scratchPath == "" {
+		scratchPath = filepath.Join(os.TempDir(), "tubely")
+	}
+	scratchDir, err := scratch.New(scratchPath)
+	if err != nil {
+		log.Fatalf("Couldn't create scratch directory: %v", err)
+	}
+	scratchMinFree := int64(1 << 30)
+	if value := os.Getenv("SCRATCH_MIN_FREE_BYTES"); value != "" {
+		scratchMinFree, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || scratchMinFree < 0 {
+			log.Fatalf("SCRATCH_MIN_FREE_BYTES must be a non-negative number: %q", value)
+		}
+	}
+	scratchMaxAge := 6 * time.Hour
+	if value := os.Getenv("SCRATCH_MAX_AGE"); value != "" {
+		scratchMaxAge, err = time.ParseDuration(value)
+		if err != nil || scratchMaxAge <= 0 {
+			log.Fatalf("SCRATCH_MAX_AGE must be a positive duration: %q", value)
+		}
+	}
+
+	// Optional: how long deleted videos stay in the trash before they and
+	// their files are deleted for good
+	trashRetention := 30 * 24 * time.Hour
+	if value := os.Getenv("TRASH_RETENTION"); value != "" {
+		trashRetention, err = time.ParseDuration(value)
+		if err != nil || trashRetention <= 0 {
+			log.Fatalf("TRASH_RETENTION must be a positive duration: %q", value)
+		}
+	}
+
+	// Optional: behind a proxy or CDN, the audit log takes client IPs from
+	// X-Forwarded-For. Don't enable it when clients can reach the server
+	// directly, they could put anything in the header.
+	trustProxyHeaders := false
+	if value := os.Getenv("TRUST_PROXY_HEADERS"); value != "" {
+		trustProxyHeaders, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("TRUST_PROXY_HEADERS must be a boolean: %v", err)
+		}
+	}
+
+	// Optional: a deployment wide watermark, used for users without their own.
+	// Position, opacity and scale are also the defaults for user watermarks.
+	watermark := watermarkSettings{
+		imagePath: os.Getenv("WATERMARK_IMAGE"),
+		position:  "bottom-right",
+		opacity:   0.5,
+		scale:     0.15,
+	}
+	if value := os.Getenv("WATERMARK_POSITION"); value != "" {
+		watermark.position = value
+	}
+	if value := os.Getenv("WATERMARK_OPACITY"); value != "" {
+		watermark.opacity, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("WATERMARK_OPACITY must be a number: %v", err)
+		}
+	}
+	if value := os.Getenv("WATERMARK_SCALE"); value != "" {
+		watermark.scale, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("WATERMARK_SCALE must be a number: %v", err)
+		}
+	}
+	if err := watermark.validate(); err != nil {
+		log.Fatalf("Invalid watermark configuration: %v", err)
+	}
+	if watermark.imagePath != "" {
+		if _, err := getImageWidth(watermark.imagePath); err != nil {
+			log.Fatalf("WATERMARK_IMAGE is not a usable image: %v", err)
+		}
+	}
+
+	// Optional: where ffmpeg and ffprobe live and how long they may run
+	ffmpegTimeout := 30 * time.Minute
+	if value := os.Getenv("FFMPEG_TIMEOUT"); value != "" {
+		ffmpegTimeout, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("FFMPEG_TIMEOUT must be a duration: %v", err)
+		}
+	}
+	ffprobeTimeout := 30 * time.Second
+	if value := os.Getenv("FFPROBE_TIMEOUT"); value != "" {
+		ffprobeTimeout, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("FFPROBE_TIMEOUT must be a duration: %v", err)
+		}
+	}
+
+	// Optional: how many ffmpeg/ffprobe runs may go on at once, and how
+	// many may wait for their turn before uploads are turned away
+	remuxWorkers := runtime.NumCPU()
+	if value := os.Getenv("MEDIA_REMUX_WORKERS"); value != "" {
+		remuxWorkers, err = strconv.Atoi(value)
+		if err != nil || remuxWorkers < 1 {
+			log.Fatalf("MEDIA_REMUX_WORKERS must be a positive number: %q", value)
+		}
+	}
+	transcodeWorkers := max(1, runtime.NumCPU()/2)
+	if value := os.Getenv("MEDIA_TRANSCODE_WORKERS"); value != "" {
+		transcodeWorkers, err = strconv.Atoi(value)
+		if err != nil || transcodeWorkers < 1 {
+			log.Fatalf("MEDIA_TRANSCODE_WORKERS must be a positive number: %q", value)
+		}
+	}
+	mediaQueueSize := 8
+	if value := os.Getenv("MEDIA_QUEUE_SIZE"); value != "" {
+		mediaQueueSize, err = strconv.Atoi(value)
+		if err != nil || mediaQueueSize < 0 {
+			log.Fatalf("MEDIA_QUEUE_SIZE must be a non-negative number: %q", value)
+		}
+	}
+
+	mediaRunner := media.NewRunner(media.Config{
+		FFmpegPath:       os.Getenv("FFMPEG_PATH"),
+		FFprobePath:      os.Getenv("FFPROBE_PATH"),
+		FFmpegTimeout:    ffmpegTimeout,
+		FFprobeTimeout:   ffprobeTimeout,
+		RemuxWorkers:     remuxWorkers,
+		TranscodeWorkers: transcodeWorkers,
+		QueueSize:        mediaQueueSize,
+	})
+	err = mediaRunner.CheckBinaries(context.Background())
+	if err != nil {
+		log.Fatalf("ffmpeg and ffprobe are required: %v", err)
+	}
+
 	cfg := apiConfig{
 		db:               db,
 		jwtSecret:        jwtSecret,
@@ -96,7 +319,31 @@ func main() {
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
 		port:             port,
+		loudnessNormalize:  loudnessNormalize,
+		loudnessTargetLUFS: loudnessTargetLUFS,
+		audioRendition:     audioRendition,
+		quota:              quota,
+		adminEmails:        adminEmails,
+		watermark:          watermark,
+		media:              mediaRunner,
+		progress:           progress.NewHub(time.Minute),
+		scratch:            scratchDir,
+		scratchMinFree:     scratchMinFree,
+		trashRetention:     trashRetention,
+		trustProxyHeaders:  trustProxyHeaders,
+	}
+
+	// Older versions kept temp files straight in the system temp dir
+	for _, dir := range []string{scratchDir.Path(), os.TempDir()} {
+		removed, err := scratch.Sweep(dir, scratchMaxAge)
+		if err != nil {
+			log.Fatalf("Couldn't sweep scratch directory: %v", err)
+		}
+		if removed > 0 {
+			log.Printf("Removed %d stale entries from %s\n", removed, dir)
+		}
 	}
+	scratchDir.StartSweeper(context.Background(), 15*time.Minute, scratchMaxAge)
 
 	err = cfg.ensureAssetsDir()
 	if err != nil {
@@ -122,21 +369,75 @@ func main() {
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("DELETE /api/users", cfg.handlerUsersDelete)
+	mux.HandleFunc("GET /api/me/usage", cfg.handlerUsage)
+	mux.HandleFunc("GET /api/users/{userID}/playlists", cfg.handlerPublicPlaylistsList)
+
+	mux.HandleFunc("GET /api/watermark", cfg.handlerWatermarkGet)
+	mux.HandleFunc("PUT /api/watermark", cfg.handlerWatermarkUpload)
+	mux.HandleFunc("DELETE /api/watermark", cfg.handlerWatermarkDelete)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/videos/search", cfg.handlerVideosSearch)
+	mux.HandleFunc("GET /api/videos/trash", cfg.handlerVideosTrash)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/restore", cfg.handlerVideoRestore)
+	mux.HandleFunc("PUT /api/videos/{videoID}/tags", cfg.handlerVideoTagsUpdate)
+	mux.HandleFunc("PUT /api/videos/{videoID}/category", cfg.handlerVideoCategoryUpdate)
+	mux.HandleFunc("POST /api/videos/{videoID}/clip", cfg.handlerVideoClip)
+	mux.HandleFunc("GET /api/videos/{videoID}/storyboard.vtt", cfg.handlerStoryboardVTT)
+	mux.HandleFunc("GET /api/videos/{videoID}/progress", cfg.handlerVideoProgress)
+	mux.HandleFunc("POST /api/videos/{videoID}/progress-token", cfg.handlerVideoProgressToken)
+	mux.HandleFunc("GET /api/videos/{videoID}/versions", cfg.handlerVideoVersionsList)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/versions", cfg.handlerVideoVersionsPurge)
+	mux.HandleFunc("POST /api/videos/{videoID}/versions/{version}/rollback", cfg.handlerVideoVersionRollback)
+
+	mux.HandleFunc("POST /api/playlists", cfg.handlerPlaylistCreate)
+	mux.HandleFunc("GET /api/playlists", cfg.handlerPlaylistsList)
+	mux.HandleFunc("GET /api/playlists/{playlistID}", cfg.handlerPlaylistGet)
+	mux.HandleFunc("PUT /api/playlists/{playlistID}", cfg.handlerPlaylistUpdate)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}", cfg.handlerPlaylistDelete)
+	mux.HandleFunc("POST /api/playlists/{playlistID}/videos", cfg.handlerPlaylistVideoAdd)
+	mux.HandleFunc("PUT /api/playlists/{playlistID}/videos", cfg.handlerPlaylistReorder)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}/videos/{videoID}", cfg.handlerPlaylistVideoRemove)
+
+	mux.HandleFunc("GET /api/tags", cfg.handlerTagsList)
+	mux.HandleFunc("GET /api/categories", cfg.handlerCategoriesList)
+
+	mux.HandleFunc("GET /api/videos/{videoID}/captions", cfg.handlerCaptionsList)
+	mux.HandleFunc("POST /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionUpload)
+	mux.HandleFunc("PUT /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionReplace)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionDelete)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("DELETE /admin/users/{userID}", cfg.handlerAdminUserDelete)
+	mux.HandleFunc("GET /admin/users/{userID}/quota", cfg.handlerUserQuotaGet)
+	mux.HandleFunc("PUT /admin/users/{userID}/quota", cfg.handlerUserQuotaUpdate)
+	mux.HandleFunc("DELETE /admin/users/{userID}/quota", cfg.handlerUserQuotaDelete)
+	mux.HandleFunc("GET /admin/audit-events", cfg.handlerAuditEventsList)
+	mux.HandleFunc("GET /admin/audit-events/export", cfg.handlerAuditEventsExport)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
 	}
 
+	// These go to S3, so they have to wait for the client
+	cfg.startTrashPurger(context.Background(), trashPurgeInterval)
+	go func() {
+		sized, err := cfg.backfillVersionSizes(context.Background())
+		if err != nil {
+			log.Printf("Couldn't backfill version sizes: %v\n", err)
+		} else if sized > 0 {
+			log.Printf("Recorded the size of %d older versions\n", sized)
+		}
+	}()
+
 	log.Printf("Serving on: http://localhost:%s/app/\n", port)
 	log.Fatal(srv.ListenAndServe())
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const migrateUsage = `usage: tubely migrate [command]
+
+commands:
+  up          apply every pending migration (the default)
+  down [n]    roll back the last n migrations (1 by default)
+  to <n>      migrate up or down to schema version n, 0 drops everything
+  status      list the migrations and which of them are applied`
+
+// runMigrate implements `tubely migrate`. The server migrates to the
+// latest version on its own at startup, this is for inspecting a database
+// or rolling it back.
+func runMigrate(pathToDB string, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+		args = args[1:]
+	}
+
+	db, err := database.Open(pathToDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		if len(args) != 0 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		err = db.Migrate()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		if len(args) == 1 {
+			steps, err = strconv.Atoi(args[0])
+			if err != nil || steps < 0 {
+				return fmt.Errorf("down takes a non-negative number of migrations\n\n%s", migrateUsage)
+			}
+		}
+		var current int
+		current, err = db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		err = db.MigrateTo(max(0, current-steps))
+	case "to":
+		if len(args) != 1 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		var target int
+		target, err = strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("to takes a schema version\n\n%s", migrateUsage)
+		}
+		err = db.MigrateTo(target)
+	case "status":
+		var statuses []database.MigrationStatus
+		statuses, err = db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", command, migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database is at schema version %d\n", version)
+	return nil
+}
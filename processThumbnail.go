@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+)
+
+// Widths the thumbnail is resized to. Widths larger than the source image
+// are skipped, so small uploads are never upscaled.
+var thumbnailWidths = []int{320, 640, 1280}
+
+type thumbnailFormat struct {
+	mimeType  string
+	extension string
+	codecArgs []string
+}
+
+var thumbnailFormats = []thumbnailFormat{
+	{mimeType: "image/jpeg", extension: "jpg", codecArgs: []string{"-c:v", "mjpeg", "-q:v", "3"}},
+	{mimeType: "image/webp", extension: "webp", codecArgs: []string{"-c:v", "libwebp", "-quality", "80"}},
+}
+
+type thumbnailRendition struct {
+	path     string
+	width    int
+	mimeType string
+}
+
+// Decodes the uploaded image and re-encodes it into every configured width
+// and format inside outputDir, named <baseName>-<width>.<ext>. Only pixels
+// survive the re-encode: EXIF, XMP and any other metadata are dropped.
+func (cfg *apiConfig) processThumbnail(ctx context.Context, filePath, outputDir, baseName string) ([]thumbnailRendition, error) {
+	sourceWidth, err := getImageWidth(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	widths := []int{}
+	for _, width := range thumbnailWidths {
+		if width <= sourceWidth {
+			widths = append(widths, width)
+		}
+	}
+	if len(widths) == 0 {
+		widths = append(widths, sourceWidth)
+	}
+
+	renditions := []thumbnailRendition{}
+	for _, width := range widths {
+		for _, format := range thumbnailFormats {
+			outputPath := filepath.Join(outputDir, fmt.Sprintf("%s-%d.%s", baseName, width, format.extension))
+
+			args := []string{
+				"-y",
+				"-i", filePath,
+				"-map_metadata", "-1",
+				"-vf", fmt.Sprintf("scale=%d:-2", width),
+				"-frames:v", "1",
+			}
+			args = append(args, format.codecArgs...)
+			args = append(args, outputPath)
+
+			_, err := cfg.media.FFmpeg(ctx, args...)
+			if err != nil {
+				removeThumbnailRenditions(renditions)
+				os.Remove(outputPath)
+				return nil, fmt.Errorf("couldn't encode %dpx %s thumbnail: %w", width, format.mimeType, err)
+			}
+
+			renditions = append(renditions, thumbnailRendition{
+				path:     outputPath,
+				width:    width,
+				mimeType: format.mimeType,
+			})
+		}
+	}
+
+	return renditions, nil
+}
+
+// Reads just the image header, which also makes sure the upload really
+// is a JPEG or PNG and not something else with a faked Content-Type.
+func getImageWidth(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't decode image: %w", err)
+	}
+	if config.Width <= 0 {
+		return 0, fmt.Errorf("invalid image width %d", config.Width)
+	}
+	return config.Width, nil
+}
+
+func removeThumbnailRenditions(renditions []thumbnailRendition) {
+	for _, rendition := range renditions {
+		os.Remove(rendition.path)
+	}
+}
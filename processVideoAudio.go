@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Extracts the first audio track into an M4A file for background listening.
+// AAC audio is copied as is, anything else is encoded to AAC. Returns the
+// path of the audio file and its duration in seconds.
+func (cfg *apiConfig) processVideoAudio(ctx context.Context, filePath string) (string, float64, error) {
+	probe, err := cfg.media.Probe(ctx, filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	stream, ok := probe.AudioStream()
+	if !ok {
+		return "", 0, errNoAudioStream
+	}
+
+	codecArgs := []string{"-c:a", "aac", "-b:a", "128k"}
+	if stream.CodecName == "aac" {
+		codecArgs = []string{"-c:a", "copy"}
+	}
+
+	outputFilePath := fmt.Sprintf("%s.audio", filePath)
+	args := []string{"-y", "-i", filePath, "-map", "0:a:0", "-vn"}
+	args = append(args, codecArgs...)
+	args = append(args, "-movflags", "faststart", "-f", "ipod", outputFilePath)
+
+	// Only audio is encoded, if anything, so this is a light run
+	_, err = cfg.media.Remux(ctx, args...)
+	if err != nil {
+		return "", 0, err
+	}
+
+	duration, err := cfg.getVideoDuration(ctx, outputFilePath)
+	if err != nil {
+		os.Remove(outputFilePath)
+		return "", 0, err
+	}
+	return outputFilePath, duration, nil
+}
+
+// Creates the audio-only rendition of the video at filePath and stores it
+// next to the video's object. Like the preview it is optional: failures
+// are logged and nil is returned. So is a video without audio.
+func (cfg *apiConfig) uploadAudio(ctx context.Context, videoID uuid.UUID, filePath, videoKey string) *database.AudioRendition {
+	audioFileName, duration, err := cfg.processVideoAudio(ctx, filePath)
+	if errors.Is(err, errNoAudioStream) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Unable to extract audio of %s: %v\n", videoID, err)
+		return nil
+	}
+	defer os.Remove(audioFileName)
+
+	audioLocation, err := cfg.putFile(ctx, videoKey+".audio.m4a", "audio/mp4", audioFileName)
+	if err != nil {
+		log.Printf("Unable to copy audio of %s to S3: %v\n", videoID, err)
+		return nil
+	}
+	return &database.AudioRendition{
+		AudioURL:        audioLocation,
+		DurationSeconds: duration,
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Cuts the [start, end) range in seconds out of the video. Without
+// reencode the streams are copied and the cut snaps to the keyframe at or
+// before start, which is fast and lossless. With reencode the cut is frame
+// accurate at the cost of a full H.264/AAC transcode.
+func (cfg *apiConfig) processVideoClip(ctx context.Context, filePath string, start, end float64, reencode bool) (string, error) {
+	outputFilePath := fmt.Sprintf("%s.clip", filePath)
+
+	args := []string{
+		"-y",
+		"-ss", formatSeconds(start),
+		"-i", filePath,
+		"-t", formatSeconds(end-start),
+	}
+	if reencode {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-c:a", "aac", "-b:a", "192k")
+	} else {
+		args = append(args, "-c", "copy", "-avoid_negative_ts", "make_zero")
+	}
+	args = append(args, "-movflags", "faststart", "-f", "mp4", outputFilePath)
+
+	run := cfg.media.Remux
+	if reencode {
+		run = cfg.media.FFmpeg
+	}
+	_, err := run(ctx, args...)
+	if err != nil {
+		return filePath, err
+	}
+
+	return outputFilePath, nil
+}
@@ -1,24 +1,24 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
 )
 
-func processVideoForFastStart(filePath string) (string, error) {
+// metadataArgs go after "-c copy", so they can override the codec of
+// some streams, e.g. the ones of stripMetadataArgs
+func (cfg *apiConfig) processVideoForFastStart(ctx context.Context, filePath string, metadataArgs ...string) (string, error) {
 	outputFilePath := fmt.Sprintf("%s.processing", filePath)
 
-	cmd := exec.Command("ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilePath)
-	
-	var out bytes.Buffer
-	cmd.Stdout = &out
+	args := []string{"-i", filePath, "-c", "copy"}
+	args = append(args, metadataArgs...)
+	args = append(args, "-movflags", "faststart", "-f", "mp4", outputFilePath)
 
-	err := cmd.Run()
+	_, err := cfg.media.Remux(ctx, args...)
 	if err != nil {
 		return filePath, err
 	}
 
 	return outputFilePath, nil
 
-}
\ No newline at end of file
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// Maximum true peak and loudness range passed to loudnorm, per EBU R128 s1
+const (
+	loudnessTruePeak = -1.5
+	loudnessRange    = 11.0
+)
+
+var errNoAudioStream = errors.New("video has no audio stream")
+
+// loudnorm measures silence as "-inf", which can't be normalised or stored
+var errSilentAudio = errors.New("audio is silent")
+
+// What loudnorm prints on stderr after a measuring pass with print_format=json.
+// The values are strings, e.g. "input_i" : "-27.61"
+type loudnormMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// Normalises the audio track to targetLUFS with ffmpeg's two-pass loudnorm
+// filter. The first pass measures the EBU R128 loudness of the input, the
+// second re-encodes the audio using those measurements while copying the
+// video stream untouched. Returns the path of the normalised file.
+func (cfg *apiConfig) processVideoLoudness(ctx context.Context, filePath string, targetLUFS float64) (string, database.Loudness, error) {
+	probe, err := cfg.media.Probe(ctx, filePath)
+	if err != nil {
+		return filePath, database.Loudness{}, err
+	}
+	if !probe.HasAudio() {
+		return filePath, database.Loudness{}, errNoAudioStream
+	}
+
+	measurement, err := cfg.measureLoudness(ctx, filePath, targetLUFS)
+	if err != nil {
+		return filePath, database.Loudness{}, err
+	}
+
+	measuredLUFS, err := strconv.ParseFloat(measurement.InputI, 64)
+	if err != nil {
+		return filePath, database.Loudness{}, fmt.Errorf("invalid measured loudness %q: %w", measurement.InputI, err)
+	}
+	measuredTruePeak, err := strconv.ParseFloat(measurement.InputTP, 64)
+	if err != nil {
+		return filePath, database.Loudness{}, fmt.Errorf("invalid measured true peak %q: %w", measurement.InputTP, err)
+	}
+	if !isFinite(measuredLUFS) || !isFinite(measuredTruePeak) {
+		return filePath, database.Loudness{}, fmt.Errorf("%w: measured %s LUFS, true peak %s", errSilentAudio, measurement.InputI, measurement.InputTP)
+	}
+
+	outputFilePath := fmt.Sprintf("%s.loudnorm", filePath)
+	filter := fmt.Sprintf(
+		"loudnorm=I=%g:TP=%g:LRA=%g:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		targetLUFS, loudnessTruePeak, loudnessRange,
+		measurement.InputI, measurement.InputTP, measurement.InputLRA, measurement.InputThresh, measurement.TargetOffset,
+	)
+
+	// Every stream is kept and copied, only the audio is re-encoded
+	_, err = cfg.media.Remux(ctx, "-i", filePath, "-map", "0", "-c", "copy", "-af", filter, "-c:a", "aac", "-b:a", "192k", "-f", "mp4", outputFilePath)
+	if err != nil {
+		return filePath, database.Loudness{}, err
+	}
+
+	return outputFilePath, database.Loudness{
+		MeasuredLUFS:     measuredLUFS,
+		MeasuredTruePeak: measuredTruePeak,
+		TargetLUFS:       targetLUFS,
+	}, nil
+}
+
+func isFinite(value float64) bool {
+	return !math.IsInf(value, 0) && !math.IsNaN(value)
+}
+
+func (cfg *apiConfig) measureLoudness(ctx context.Context, filePath string, targetLUFS float64) (loudnormMeasurement, error) {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:print_format=json", targetLUFS, loudnessTruePeak, loudnessRange)
+	result, err := cfg.media.Remux(ctx, "-nostats", "-i", filePath, "-vn", "-af", filter, "-f", "null", "-")
+	if err != nil {
+		return loudnormMeasurement{}, err
+	}
+
+	// loudnorm reports on stderr, after ffmpeg's own log lines
+	output := []byte(result.Stderr)
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start == -1 || end < start {
+		return loudnormMeasurement{}, errors.New("no loudnorm measurement in ffmpeg output")
+	}
+
+	measurement := loudnormMeasurement{}
+	err = json.Unmarshal(output[start:end+1], &measurement)
+	if err != nil {
+		return loudnormMeasurement{}, err
+	}
+	return measurement, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Tags kept when metadata is stripped, because they change how the video
+// plays. Newer ffmpeg keeps rotation as side data, which stream copies
+// keep anyway; older ones only have the rotate tag.
+var playbackTags = map[string]bool{
+	"rotate":   true,
+	"language": true,
+}
+
+// Tags the MP4 muxer writes into every file. They are replaced, not
+// stripped, so they aren't worth reporting.
+var containerTags = map[string]bool{
+	"major_brand":       true,
+	"minor_version":     true,
+	"compatible_brands": true,
+	"handler_name":      true,
+	"vendor_id":         true,
+}
+
+// Subtitle codecs that are pictures. MP4 only holds text subtitles, as
+// mov_text, so these can't be kept.
+var bitmapSubtitleCodecs = map[string]bool{
+	"dvd_subtitle":      true,
+	"dvb_subtitle":      true,
+	"hdmv_pgs_subtitle": true,
+	"xsub":              true,
+}
+
+// Builds the remux arguments that drop all metadata of the file at
+// filePath (GPS location, device make and model, software, ...) but the
+// playbackTags of its streams. Every video, audio and text subtitle
+// stream is kept; data streams like GPS tracks and GoPro telemetry go
+// entirely. The arguments go after "-c copy", they convert subtitles to
+// mov_text. Also returns what is stripped, as "format:<tag>",
+// "stream <index>:<tag>" and "stream <index>" for dropped streams, so
+// what was removed is known without keeping any of the values.
+func (cfg *apiConfig) stripMetadataArgs(ctx context.Context, filePath string) ([]string, []string, error) {
+	probe, err := cfg.media.Probe(ctx, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := []string{"-map_metadata", "-1", "-map_chapters", "-1"}
+	stripped := []string{}
+	for _, key := range sortedKeys(probe.Format.Tags) {
+		if !containerTags[key] {
+			stripped = append(stripped, "format:"+key)
+		}
+	}
+
+	output := 0
+	hasSubtitles := false
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video", stream.CodecType == "audio":
+		case stream.CodecType == "subtitle" && !bitmapSubtitleCodecs[stream.CodecName]:
+			hasSubtitles = true
+		default:
+			stripped = append(stripped, fmt.Sprintf("stream %d", stream.Index))
+			continue
+		}
+		args = append(args, "-map", fmt.Sprintf("0:%d", stream.Index))
+
+		// Output streams are numbered in the order they are mapped
+		specifier := strconv.Itoa(output)
+		output++
+		for _, key := range sortedKeys(stream.Tags) {
+			switch {
+			case playbackTags[key]:
+				args = append(args, "-metadata:s:"+specifier, key+"="+stream.Tags[key])
+			case !containerTags[key]:
+				stripped = append(stripped, fmt.Sprintf("stream %d:%s", stream.Index, key))
+			}
+		}
+	}
+	if hasSubtitles {
+		args = append(args, "-c:s", "mov_text")
+	}
+
+	return args, stripped, nil
+}
+
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
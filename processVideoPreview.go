@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// The hover preview is previewSnippets clips of previewSnippetLength
+// seconds each, spread evenly over the video, scaled down to previewWidth
+// and without audio.
+const (
+	previewSnippets      = 4
+	previewSnippetLength = 1.5
+	previewWidth         = 320
+	previewFPS           = 15
+)
+
+// Builds a short, muted, low resolution MP4 for hover playback out of a
+// few evenly spaced snippets of the video. Videos too short to have
+// separate snippets are previewed from the start.
+func (cfg *apiConfig) processVideoPreview(ctx context.Context, filePath string) (string, error) {
+	duration, err := cfg.getVideoDuration(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	outputFilePath := fmt.Sprintf("%s.preview", filePath)
+	scale := fmt.Sprintf("scale=%d:-2,fps=%d,setsar=1", previewWidth, previewFPS)
+
+	args := []string{"-y"}
+	filter := ""
+	if duration < previewSnippets*previewSnippetLength*2 {
+		length := min(duration, previewSnippets*previewSnippetLength)
+		args = append(args, "-t", formatSeconds(length), "-i", filePath)
+		filter = fmt.Sprintf("[0:v]%s[out]", scale)
+	} else {
+		// Snippet i is centred on (i+0.5)/n of the way through the video
+		parts := []string{}
+		labels := ""
+		for i := 0; i < previewSnippets; i++ {
+			start := duration*(float64(i)+0.5)/previewSnippets - previewSnippetLength/2
+			args = append(args, "-ss", formatSeconds(start), "-t", formatSeconds(previewSnippetLength), "-i", filePath)
+			parts = append(parts, fmt.Sprintf("[%d:v]%s[v%d]", i, scale, i))
+			labels += fmt.Sprintf("[v%d]", i)
+		}
+		filter = fmt.Sprintf("%s;%sconcat=n=%d:v=1:a=0[out]", strings.Join(parts, ";"), labels, previewSnippets)
+	}
+
+	args = append(args,
+		"-filter_complex", filter,
+		"-map", "[out]",
+		"-an",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "30", "-pix_fmt", "yuv420p",
+		"-movflags", "faststart",
+		"-f", "mp4", outputFilePath,
+	)
+
+	_, err = cfg.media.FFmpeg(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	return outputFilePath, nil
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// Creates the hover preview of the video at filePath and stores it next to
+// the video's object. The preview is a nice to have: failures are logged
+// and nil is returned, so the upload itself still succeeds.
+func (cfg *apiConfig) uploadPreview(ctx context.Context, videoID uuid.UUID, filePath, videoKey string) *string {
+	previewFileName, err := cfg.processVideoPreview(ctx, filePath)
+	if err != nil {
+		log.Printf("Unable to create preview for %s: %v\n", videoID, err)
+		return nil
+	}
+	defer os.Remove(previewFileName)
+
+	previewLocation, err := cfg.putFile(ctx, videoKey+".preview.mp4", "video/mp4", previewFileName)
+	if err != nil {
+		log.Printf("Unable to copy preview of %s to S3: %v\n", videoID, err)
+		return nil
+	}
+	return &previewLocation
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Storyboard frames are taken every storyboardMinInterval seconds, or
+// less often for videos long enough to need more than storyboardMaxFrames.
+const (
+	storyboardMinInterval = 5.0
+	storyboardMaxFrames   = 500
+	storyboardColumns     = 10
+	storyboardRows        = 10
+	storyboardTileWidth   = 160
+)
+
+const storyboardVTTName = "storyboard.vtt"
+
+func storyboardSpriteName(sheet int) string {
+	return fmt.Sprintf("sprite-%03d.jpg", sheet+1)
+}
+
+// Grabs a frame at fixed intervals and tiles them into JPEG sprite sheets
+// inside outputDir, named like storyboardSpriteName. The returned
+// storyboard has everything but its storage location.
+func (cfg *apiConfig) processVideoStoryboard(ctx context.Context, filePath, outputDir string) (database.Storyboard, error) {
+	duration, err := cfg.getVideoDuration(ctx, filePath)
+	if err != nil {
+		return database.Storyboard{}, err
+	}
+	width, height, err := cfg.getVideoDimensions(ctx, filePath)
+	if err != nil {
+		return database.Storyboard{}, err
+	}
+
+	interval := math.Max(storyboardMinInterval, math.Ceil(duration/storyboardMaxFrames))
+	frameCount := max(1, int(math.Ceil(duration/interval)))
+	framesPerSheet := storyboardColumns * storyboardRows
+
+	// Even height, so every tile (and so every xywh region) has the same size
+	tileHeight := int(math.Round(float64(storyboardTileWidth)*float64(height)/float64(width)/2)) * 2
+
+	filter := fmt.Sprintf(
+		"fps=1/%g,scale=%d:%d,tile=%dx%d",
+		interval, storyboardTileWidth, tileHeight, storyboardColumns, storyboardRows,
+	)
+	_, err = cfg.media.FFmpeg(ctx, "-y",
+		"-i", filePath,
+		"-an",
+		"-vf", filter,
+		"-q:v", "5",
+		"-f", "image2",
+		filepath.Join(outputDir, "sprite-%03d.jpg"),
+	)
+	if err != nil {
+		return database.Storyboard{}, err
+	}
+
+	// ffmpeg's frame count can be off by one from ours at the very end, so
+	// trust the sheets it actually wrote
+	sheets, err := filepath.Glob(filepath.Join(outputDir, "sprite-*.jpg"))
+	if err != nil {
+		return database.Storyboard{}, err
+	}
+	if len(sheets) == 0 {
+		return database.Storyboard{}, fmt.Errorf("ffmpeg wrote no storyboard sheets")
+	}
+	frameCount = min(frameCount, len(sheets)*framesPerSheet)
+
+	return database.Storyboard{
+		SheetCount:      (frameCount + framesPerSheet - 1) / framesPerSheet,
+		FrameCount:      frameCount,
+		IntervalSeconds: interval,
+		DurationSeconds: duration,
+		Columns:         storyboardColumns,
+		Rows:            storyboardRows,
+		TileWidth:       storyboardTileWidth,
+		TileHeight:      tileHeight,
+	}, nil
+}
+
+// Writes the WebVTT thumbnails track: one cue per frame, pointing at the
+// frame's region of its sprite sheet with a #xywh= media fragment.
+func buildStoryboardVTT(storyboard database.Storyboard, spriteURL func(sheet int) string) string {
+	framesPerSheet := storyboard.Columns * storyboard.Rows
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for frame := 0; frame < storyboard.FrameCount; frame++ {
+		start := float64(frame) * storyboard.IntervalSeconds
+		end := math.Min(start+storyboard.IntervalSeconds, storyboard.DurationSeconds)
+		position := frame % framesPerSheet
+		x := (position % storyboard.Columns) * storyboard.TileWidth
+		y := (position / storyboard.Columns) * storyboard.TileHeight
+
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			formatVTTTimestamp(start), formatVTTTimestamp(end),
+			spriteURL(frame/framesPerSheet),
+			x, y, storyboard.TileWidth, storyboard.TileHeight,
+		)
+	}
+	return b.String()
+}
+
+func formatVTTTimestamp(seconds float64) string {
+	millis := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
+
+// Lists the storage locations of the sheets and index of a stored storyboard
+func storyboardObjects(storyboard database.Storyboard) []string {
+	bucket, prefix, err := parseStorageLocation(storyboard.StoryboardURL)
+	if err != nil {
+		return nil
+	}
+
+	locations := []string{storageLocation(bucket, prefix+"/"+storyboardVTTName)}
+	for sheet := 0; sheet < storyboard.SheetCount; sheet++ {
+		locations = append(locations, storageLocation(bucket, prefix+"/"+storyboardSpriteName(sheet)))
+	}
+	return locations
+}
+
+// Creates the storyboard of the video at filePath and stores the sprite
+// sheets and WebVTT index under <videoKey>.storyboard/. The stored index
+// refers to the sheets by relative name. Like the preview this is optional:
+// failures are logged and nil is returned.
+func (cfg *apiConfig) uploadStoryboard(ctx context.Context, videoID uuid.UUID, filePath, videoKey string) *database.Storyboard {
+	outputDir, err := cfg.scratch.Job("storyboard")
+	if err != nil {
+		log.Printf("Unable to create storyboard dir for %s: %v\n", videoID, err)
+		return nil
+	}
+	defer os.RemoveAll(outputDir)
+
+	storyboard, err := cfg.processVideoStoryboard(ctx, filePath, outputDir)
+	if err != nil {
+		log.Printf("Unable to create storyboard for %s: %v\n", videoID, err)
+		return nil
+	}
+
+	prefix := videoKey + ".storyboard"
+	for sheet := 0; sheet < storyboard.SheetCount; sheet++ {
+		name := storyboardSpriteName(sheet)
+		_, err := cfg.putFile(ctx, prefix+"/"+name, "image/jpeg", filepath.Join(outputDir, name))
+		if err != nil {
+			log.Printf("Unable to copy storyboard of %s to S3: %v\n", videoID, err)
+			return nil
+		}
+	}
+
+	vtt := buildStoryboardVTT(storyboard, storyboardSpriteName)
+	_, err = cfg.putObject(ctx, prefix+"/"+storyboardVTTName, "text/vtt", strings.NewReader(vtt))
+	if err != nil {
+		log.Printf("Unable to copy storyboard index of %s to S3: %v\n", videoID, err)
+		return nil
+	}
+
+	storyboard.StoryboardURL = storageLocation(cfg.s3Bucket, prefix)
+	return &storyboard
+}
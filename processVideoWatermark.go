@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Where the watermark goes, as ffmpeg overlay x:y expressions. W/H are
+// the video's size, w/h the scaled watermark's, with a 2% margin.
+var watermarkPositions = map[string]string{
+	"top-left":     "W*0.02:H*0.02",
+	"top-right":    "W-w-W*0.02:H*0.02",
+	"bottom-left":  "W*0.02:H-h-H*0.02",
+	"bottom-right": "W-w-W*0.02:H-h-H*0.02",
+	"center":       "(W-w)/2:(H-h)/2",
+}
+
+type watermarkSettings struct {
+	imagePath string
+	position  string
+	opacity   float64 // 0 (invisible) to 1 (opaque)
+	scale     float64 // watermark width as a fraction of the video width
+}
+
+func (s watermarkSettings) validate() error {
+	if _, ok := watermarkPositions[s.position]; !ok {
+		return fmt.Errorf("invalid watermark position %q", s.position)
+	}
+	if s.opacity <= 0 || s.opacity > 1 {
+		return fmt.Errorf("watermark opacity must be in (0, 1], got %g", s.opacity)
+	}
+	if s.scale <= 0 || s.scale > 1 {
+		return fmt.Errorf("watermark scale must be in (0, 1], got %g", s.scale)
+	}
+	return nil
+}
+
+// Burns the watermark image into the video. The video stream has to be
+// re-encoded for that; audio is copied as is.
+func (cfg *apiConfig) processVideoWatermark(ctx context.Context, filePath string, watermark watermarkSettings) (string, error) {
+	if err := watermark.validate(); err != nil {
+		return filePath, err
+	}
+
+	outputFilePath := fmt.Sprintf("%s.watermarked", filePath)
+	filter := fmt.Sprintf(
+		"[1:v][0:v]scale2ref=w=main_w*%g:h=ow/a[wm][base];[wm]format=rgba,colorchannelmixer=aa=%g[wmo];[base][wmo]overlay=%s[out]",
+		watermark.scale, watermark.opacity, watermarkPositions[watermark.position],
+	)
+
+	_, err := cfg.media.FFmpeg(ctx, "-y",
+		"-i", filePath,
+		"-i", watermark.imagePath,
+		"-filter_complex", filter,
+		"-map", "[out]",
+		"-map", "0:a?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "20",
+		"-c:a", "copy",
+		"-movflags", "faststart",
+		"-f", "mp4", outputFilePath,
+	)
+	if err != nil {
+		return filePath, err
+	}
+
+	return outputFilePath, nil
+}
+
+// Re-encodes an uploaded watermark image to PNG, keeping its alpha
+// channel but none of its metadata, the same way thumbnails are handled.
+func (cfg *apiConfig) processWatermarkImage(ctx context.Context, filePath, outputPath string) error {
+	_, err := getImageWidth(filePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.media.FFmpeg(ctx, "-y", "-i", filePath, "-map_metadata", "-1", "-frames:v", "1", "-c:v", "png", outputPath)
+	return err
+}
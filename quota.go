@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Largest single video upload, whatever the user's quota
+const maxUploadBytes = 1 << 30
+
+// Room for the multipart framing and form fields around the video file
+const uploadFormOverhead = 1 << 20
+
+// quotaLimits are the limits that apply to a user: the deployment's
+// defaults with the user's overrides on top. 0 means unlimited.
+type quotaLimits struct {
+	MaxBytes           int64   `json:"max_bytes"`
+	MaxVideos          int     `json:"max_videos"`
+	MaxDurationSeconds float64 `json:"max_duration_seconds"`
+}
+
+type quotaStatus struct {
+	database.Usage
+	Limits quotaLimits `json:"limits"`
+}
+
+func (cfg *apiConfig) quotaFor(userID uuid.UUID) (quotaStatus, error) {
+	limits := cfg.quota
+	override, err := cfg.db.GetUserQuota(userID)
+	if err != nil {
+		return quotaStatus{}, err
+	}
+	if override != nil {
+		if override.MaxBytes != nil {
+			limits.MaxBytes = *override.MaxBytes
+		}
+		if override.MaxVideos != nil {
+			limits.MaxVideos = *override.MaxVideos
+		}
+		if override.MaxDurationSeconds != nil {
+			limits.MaxDurationSeconds = *override.MaxDurationSeconds
+		}
+	}
+
+	usage, err := cfg.db.GetUsage(userID)
+	if err != nil {
+		return quotaStatus{}, err
+	}
+	return quotaStatus{Usage: usage, Limits: limits}, nil
+}
+
+// storeLimits are the limits the database checks again as it stores a
+// version, in case concurrent uploads used up the room in the meantime.
+func (q quotaStatus) storeLimits() database.QuotaLimits {
+	return database.QuotaLimits{
+		MaxBytes:  q.Limits.MaxBytes,
+		MaxVideos: q.Limits.MaxVideos,
+	}
+}
+
+// remainingBytes is -1 when storage is unlimited
+func (q quotaStatus) remainingBytes() int64 {
+	if q.Limits.MaxBytes == 0 {
+		return -1
+	}
+	return max(0, q.Limits.MaxBytes-q.Bytes)
+}
+
+func (q quotaStatus) allowsBytes(size int64) bool {
+	return q.Limits.MaxBytes == 0 || q.Bytes+size <= q.Limits.MaxBytes
+}
+
+func (q quotaStatus) allowsNewVideo() bool {
+	return q.Limits.MaxVideos == 0 || q.Videos < q.Limits.MaxVideos
+}
+
+func (q quotaStatus) allowsDuration(seconds float64) bool {
+	return q.Limits.MaxDurationSeconds == 0 || seconds <= q.Limits.MaxDurationSeconds
+}
+
+// uploadLimit is how much of a request body an upload may read: the
+// remaining storage, up to maxUploadBytes, plus the form around it.
+func (q quotaStatus) uploadLimit() int64 {
+	limit := int64(maxUploadBytes)
+	if remaining := q.remainingBytes(); remaining >= 0 {
+		limit = min(limit, remaining)
+	}
+	return limit + uploadFormOverhead
+}
+
+// Like respondWithError, with the user's usage and limits so clients can
+// tell what went over.
+func respondWithQuotaError(w http.ResponseWriter, code int, msg string, quota quotaStatus) {
+	type errorResponse struct {
+		Error string      `json:"error"`
+		Usage quotaStatus `json:"usage"`
+	}
+	respondWithJSON(w, code, errorResponse{
+		Error: msg,
+		Usage: quota,
+	})
+}
+
+func respondStorageQuotaExceeded(w http.ResponseWriter, quota quotaStatus, size int64) {
+	msg := fmt.Sprintf("Storage quota exceeded: %d bytes needed, %d of %d bytes used", size, quota.Bytes, quota.Limits.MaxBytes)
+	respondWithQuotaError(w, http.StatusRequestEntityTooLarge, msg, quota)
+}
+
+func respondDurationQuotaExceeded(w http.ResponseWriter, quota quotaStatus, seconds float64) {
+	msg := fmt.Sprintf("Video is %.1fs long, the limit is %.1fs", seconds, quota.Limits.MaxDurationSeconds)
+	respondWithQuotaError(w, http.StatusRequestEntityTooLarge, msg, quota)
+}
+
+func respondVideoQuotaExceeded(w http.ResponseWriter, quota quotaStatus) {
+	msg := fmt.Sprintf("Video quota exceeded: %d of %d videos used", quota.Videos, quota.Limits.MaxVideos)
+	respondWithQuotaError(w, http.StatusForbidden, msg, quota)
+}
+
+// Responds to a write the database refused with ErrQuotaExceeded, with the
+// usage as it is now. newVideo is whether the write also added a video.
+func (cfg *apiConfig) respondQuotaExceeded(w http.ResponseWriter, userID uuid.UUID, size int64, newVideo bool) {
+	quota, err := cfg.quotaFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	if newVideo && !quota.allowsNewVideo() {
+		respondVideoQuotaExceeded(w, quota)
+		return
+	}
+	respondStorageQuotaExceeded(w, quota, size)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Objects are referenced in the database as "bucket,key" (see CH6 L6),
+// so they can be presigned on the way out.
+func storageLocation(bucket, key string) string {
+	return fmt.Sprintf("%s,%s", bucket, key)
+}
+
+func parseStorageLocation(location string) (string, string, error) {
+	sep := strings.Split(location, ",")
+	if len(sep) != 2 || sep[0] == "" || sep[1] == "" {
+		return "", "", fmt.Errorf("No bucket/key.")
+	}
+	return sep[0], sep[1], nil
+}
+
+// Same <random-32-byte> naming the upload handlers use for new objects
+func randomObjectName() string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return base64.URLEncoding.EncodeToString(key)
+}
+
+// Uploads body to the configured bucket and returns its storage location.
+func (cfg *apiConfig) putObject(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	_, err := cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &cfg.s3Bucket,
+		Key:         &key,
+		Body:        body,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return "", err
+	}
+	return storageLocation(cfg.s3Bucket, key), nil
+}
+
+// Uploads the file at filePath, see putObject
+func (cfg *apiConfig) putFile(ctx context.Context, key, contentType, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return cfg.putObject(ctx, key, contentType, file)
+}
+
+func (cfg *apiConfig) deleteObject(ctx context.Context, location string) error {
+	bucket, key, err := parseStorageLocation(location)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	return err
+}
+
+// Returns the size in bytes of a stored object.
+func (cfg *apiConfig) objectSize(ctx context.Context, location string) (int64, error) {
+	bucket, key, err := parseStorageLocation(location)
+	if err != nil {
+		return 0, err
+	}
+	output, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if output.ContentLength == nil {
+		return 0, fmt.Errorf("no size for %s", location)
+	}
+	return *output.ContentLength, nil
+}
+
+// Streams a stored object into dst, e.g. a temp file ffmpeg can work on.
+func (cfg *apiConfig) downloadObject(ctx context.Context, location string, dst io.Writer) error {
+	bucket, key, err := parseStorageLocation(location)
+	if err != nil {
+		return err
+	}
+	output, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+
+	_, err = io.Copy(dst, output.Body)
+	return err
+}
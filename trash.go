@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// How often the trash is checked for videos past the retention
+const trashPurgeInterval = time.Hour
+
+// Permanently deletes the videos that have been in the trash for longer
+// than the retention, files included, and returns how many it deleted.
+func (cfg *apiConfig) purgeTrash(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-cfg.trashRetention)
+	videos, err := cfg.db.GetVideosTrashedBefore(cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, video := range videos {
+		versions, err := cfg.db.GetVideoVersions(video.ID)
+		if err != nil {
+			return purged, err
+		}
+		deleted, err := cfg.db.PurgeVideo(video.ID, cutoff)
+		if err != nil {
+			return purged, err
+		}
+		// Restored while the purge was running
+		if !deleted {
+			continue
+		}
+		cfg.deleteVideoMedia(ctx, video, versions)
+		// Nobody did this, the retention ran out
+		cfg.recordAuditEvent(database.AuditEvent{
+			Action:     database.AuditVideoPurge,
+			TargetType: database.AuditTargetVideo,
+			TargetID:   video.ID.String(),
+			Details:    map[string]string{"title": video.Title},
+		})
+		purged++
+	}
+	return purged, nil
+}
+
+// Purges the trash right away and then every interval until ctx is done.
+func (cfg *apiConfig) startTrashPurger(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := cfg.purgeTrash(ctx)
+			if err != nil {
+				log.Printf("Couldn't purge trash: %v\n", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d videos from the trash\n", purged)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
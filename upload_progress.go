@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/google/uuid"
+)
+
+// uploadProgress publishes the progress of one video upload to cfg.progress
+type uploadProgress struct {
+	hub     *progress.Hub
+	videoID uuid.UUID
+}
+
+// trackUpload starts publishing a new upload of the video. uploadID is
+// whatever the client picked to tell its stream apart from earlier
+// uploads', if anything.
+func (cfg *apiConfig) trackUpload(videoID uuid.UUID, uploadID string) uploadProgress {
+	cfg.progress.Start(videoID, uploadID)
+	return uploadProgress{hub: cfg.progress, videoID: videoID}
+}
+
+func (p uploadProgress) receiving(received, total int64) {
+	event := progress.Event{
+		Stage:         progress.StageReceiving,
+		BytesReceived: received,
+		BytesTotal:    total,
+	}
+	if total > 0 {
+		event.Percent = float64(received) / float64(total) * 100
+	}
+	p.hub.Publish(p.videoID, event)
+}
+
+// processing returns a context that reports the ffmpeg passes run with it
+// as the given step. duration is the length of the video in seconds.
+func (p uploadProgress) processing(ctx context.Context, step string, duration float64) context.Context {
+	p.hub.Publish(p.videoID, progress.Event{Stage: progress.StageProcessing, Step: step})
+	return media.WithProgress(ctx, duration, func(percent float64) {
+		p.hub.Publish(p.videoID, progress.Event{
+			Stage:   progress.StageProcessing,
+			Step:    step,
+			Percent: percent,
+		})
+	})
+}
+
+func (p uploadProgress) uploading(sent, total int64) {
+	event := progress.Event{Stage: progress.StageUploading}
+	if total > 0 {
+		event.Percent = float64(sent) / float64(total) * 100
+	}
+	p.hub.Publish(p.videoID, event)
+}
+
+func (p uploadProgress) completed() {
+	p.hub.Publish(p.videoID, progress.Event{Stage: progress.StageCompleted, Percent: 100})
+}
+
+func (p uploadProgress) failed(msg string) {
+	p.hub.Publish(p.videoID, progress.Event{Stage: progress.StageFailed, Error: msg})
+}
+
+// countingReader reports how many bytes went through it, whenever that
+// adds up to another whole percent of total. If the underlying reader can
+// seek (S3 uploads may rewind the body), so can the countingReader.
+type countingReader struct {
+	r           io.Reader
+	read        int64
+	total       int64
+	lastPercent int64
+	report      func(read, total int64)
+}
+
+func newCountingReader(r io.Reader, total int64, report func(read, total int64)) *countingReader {
+	return &countingReader{r: r, total: total, lastPercent: -1, report: report}
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+
+	percent := int64(0)
+	if c.total > 0 {
+		percent = c.read * 100 / c.total
+	}
+	if percent != c.lastPercent || err == io.EOF {
+		c.lastPercent = percent
+		c.report(c.read, c.total)
+	}
+	return n, err
+}
+
+func (c *countingReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := c.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("underlying reader can't seek")
+	}
+	position, err := seeker.Seek(offset, whence)
+	if err == nil {
+		c.read = position
+	}
+	return position, err
+}
+
+func (c *countingReader) Close() error {
+	if closer, ok := c.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
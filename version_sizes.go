@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// Records the size of the versions backfilled for videos uploaded before
+// sizes were, so they count towards the storage quota. Like uploads, a
+// version's size is its served file plus the original, if one was kept.
+// Versions whose files can't be read keep counting as 0 and are retried
+// at the next start. It returns how many versions it sized.
+func (cfg *apiConfig) backfillVersionSizes(ctx context.Context) (int, error) {
+	versions, err := cfg.db.GetUnsizedVideoVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	sized := 0
+	for _, version := range versions {
+		locations := []string{version.VideoURL}
+		if version.OriginalVideoURL != nil {
+			locations = append(locations, *version.OriginalVideoURL)
+		}
+
+		var sizeBytes int64
+		for _, location := range locations {
+			size, err := cfg.objectSize(ctx, location)
+			if err != nil {
+				log.Printf("Couldn't get the size of %s for version %d of video %s: %v\n", location, version.Number, version.VideoID, err)
+				sizeBytes = 0
+				break
+			}
+			sizeBytes += size
+		}
+		if sizeBytes == 0 {
+			continue
+		}
+
+		err = cfg.db.SetVideoVersionSize(version.ID, sizeBytes)
+		if err != nil {
+			return sized, err
+		}
+		sized++
+	}
+	return sized, nil
+}